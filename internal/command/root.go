@@ -1,10 +1,14 @@
 package command
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,17 +28,16 @@ var rootCmd = &cobra.Command{
 	Long: `N_m3u8DL-RE的Golang重写版本
 一个用于下载M3U8/MPD流媒体的命令行工具`,
 	Version: VERSION_INFO,
-	Run: func(cmd *cobra.Command, args []string) {
+	// 错误由main统一输出并以非零状态退出，不打印cobra的用法说明
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
 			fmt.Println("请提供M3U8/MPD URL")
-			cmd.Help()
-			return
+			return cmd.Help()
 		}
 
-		err := runDownload(cmd, args[0])
-		if err != nil {
-			// Error is already logged by the manager
-		}
+		return runDownload(cmd, args[0])
 	},
 }
 
@@ -65,6 +68,8 @@ func runDownload(cmd *cobra.Command, url string) error {
 	if ss, _ := cmd.Flags().GetString("ss"); ss != "all" {
 		subtitleSelect = ss
 	}
+	thumbnailSelect, _ := cmd.Flags().GetString("select-thumbnail")
+	thumbnailVTT, _ := cmd.Flags().GetBool("thumbnail-vtt")
 	dropVideo, _ := cmd.Flags().GetString("drop-video")
 	if dv, _ := cmd.Flags().GetString("dv"); dv != "" {
 		dropVideo = dv
@@ -107,11 +112,17 @@ func runDownload(cmd *cobra.Command, url string) error {
 	useSystemProxy, _ := cmd.Flags().GetBool("use-system-proxy")
 	customRange, _ := cmd.Flags().GetString("custom-range")
 	adKeywords, _ := cmd.Flags().GetStringSlice("ad-keyword")
+	selectPeriod, _ := cmd.Flags().GetString("select-period")
+	dropAdPeriods, _ := cmd.Flags().GetBool("drop-ad-periods")
+	dropAdEvents, _ := cmd.Flags().GetBool("drop-ad-events")
 
 	// 加密解密参数
 	decryptEngine, _ := cmd.Flags().GetString("decrypt-engine")
 	keys, _ := cmd.Flags().GetStringSlice("key")
 	keyTextFile, _ := cmd.Flags().GetString("key-text-file")
+	keyContentID, _ := cmd.Flags().GetString("key-content-id")
+	keyStoreAppend, _ := cmd.Flags().GetBool("key-store-append")
+	inspectEncryption, _ := cmd.Flags().GetBool("inspect-encryption")
 	mp4RealTimeDecryption, _ := cmd.Flags().GetBool("mp4-real-time-decryption")
 	useShakaPackager, _ := cmd.Flags().GetBool("use-shaka-packager")
 	customHlsMethod, _ := cmd.Flags().GetString("custom-hls-method")
@@ -144,6 +155,8 @@ func runDownload(cmd *cobra.Command, url string) error {
 	decryptionBinaryPath, _ := cmd.Flags().GetString("decryption-binary-path")
 	disableUpdateCheck, _ := cmd.Flags().GetBool("disable-update-check")
 	allowHlsMultiExtMap, _ := cmd.Flags().GetBool("allow-hls-multi-ext-map")
+	contentProcessors, _ := cmd.Flags().GetStringArray("content-processor")
+	keyProcessors, _ := cmd.Flags().GetStringArray("key-processor")
 
 	// 忽略未使用的变量警告
 	_ = saveDir
@@ -151,9 +164,6 @@ func runDownload(cmd *cobra.Command, url string) error {
 	_ = downloadRetryCount
 	_ = webRequestRetryCount
 	_ = httpRequestTimeout
-	_ = dropVideo
-	_ = dropAudio
-	_ = dropSubtitle
 	_ = logFilePath
 	_ = uiLanguage
 	_ = forceAnsiConsole
@@ -170,14 +180,20 @@ func runDownload(cmd *cobra.Command, url string) error {
 	_ = useSystemProxy
 	_ = customRange
 	_ = adKeywords
-	_ = decryptEngine
-	_ = keys
-	_ = keyTextFile
-	_ = mp4RealTimeDecryption
-	_ = useShakaPackager
-	_ = customHlsMethod
-	_ = customHlsKey
-	_ = customHlsIv
+	// 解析流选择和排除条件
+	streamFilters := map[string]string{
+		"select-video": videoSelect, "select-audio": audioSelect, "select-subtitle": subtitleSelect,
+		"drop-video": dropVideo, "drop-audio": dropAudio, "drop-subtitle": dropSubtitle,
+	}
+	parsedFilters := make(map[string]*entity.StreamFilter, len(streamFilters))
+	for name, input := range streamFilters {
+		filter, err := parseStreamFilter(input)
+		if err != nil {
+			return fmt.Errorf("解析--%s参数失败: %w", name, err)
+		}
+		parsedFilters[name] = filter
+	}
+
 	// 解析混流参数
 	var muxOptions *entity.MuxOptions
 	if cmd.Flags().Changed("mux-after-done") {
@@ -235,8 +251,6 @@ func runDownload(cmd *cobra.Command, url string) error {
 	_ = urlProcessor
 	_ = urlProcessorArgs
 	_ = ffmpegBinaryPath
-	_ = mp4decryptBinaryPath
-	_ = decryptionBinaryPath
 	_ = disableUpdateCheck
 	_ = allowHlsMultiExtMap
 	_ = maxSpeed
@@ -273,6 +287,27 @@ func runDownload(cmd *cobra.Command, url string) error {
 
 	// 创建流提取器
 	extractor := parser.NewStreamExtractor()
+	if customHlsMethod != "" || customHlsKey != "" || customHlsIv != "" {
+		method, key, iv, err := parseCustomHLSEncryption(customHlsMethod, customHlsKey, customHlsIv)
+		if err != nil {
+			return err
+		}
+		extractor.SetCustomHLSEncryption(method, key, iv)
+	}
+	for _, spec := range contentProcessors {
+		processor, err := parser.NewContentProcessor(spec)
+		if err != nil {
+			return fmt.Errorf("解析内容处理器参数失败: %w", err)
+		}
+		extractor.AddContentProcessor(processor)
+	}
+	for _, spec := range keyProcessors {
+		processor, err := parser.NewKeyProcessor(spec)
+		if err != nil {
+			return fmt.Errorf("解析密钥处理器参数失败: %w", err)
+		}
+		extractor.AddKeyProcessor(processor)
+	}
 
 	// 提取流信息
 	streams, err := extractor.ExtractStreams(url, headers)
@@ -286,6 +321,14 @@ func runDownload(cmd *cobra.Command, url string) error {
 
 	util.Logger.Info(fmt.Sprintf("解析完成，找到 %d 个流", len(streams)))
 
+	// 未指定混流标题时，使用EXT-X-SESSION-DATA中的标题
+	if muxOptions != nil && muxOptions.Title == "" {
+		if title := sessionDataTitle(streams); title != "" {
+			muxOptions.Title = title
+			util.Logger.Info("使用会话数据中的标题: %s", title)
+		}
+	}
+
 	// 对流进行排序（按照C#版本的逻辑）
 	streams = util.SortStreams(streams)
 
@@ -295,6 +338,12 @@ func runDownload(cmd *cobra.Command, url string) error {
 		util.Logger.InfoMarkUp(stream.ToString())
 	}
 
+	// 先排除--drop-*匹配的流，之后的自动、条件和交互式选择都只在剩余的流中进行
+	streams = extractor.DropStreams(streams, parsedFilters["drop-video"], parsedFilters["drop-audio"], parsedFilters["drop-subtitle"])
+	if len(streams) == 0 {
+		return fmt.Errorf("排除后没有可用的流")
+	}
+
 	var filteredStreams []*entity.StreamSpec
 
 	// 判断是否有明确的选择条件
@@ -306,7 +355,7 @@ func runDownload(cmd *cobra.Command, url string) error {
 		util.Logger.Info("自动选择模式已启用")
 	} else if hasSelectConditions {
 		// 有明确的过滤条件，直接过滤
-		filteredStreams = extractor.FilterStreams(streams, videoSelect, audioSelect, subtitleSelect)
+		filteredStreams = extractor.FilterStreams(streams, parsedFilters["select-video"], parsedFilters["select-audio"], parsedFilters["select-subtitle"])
 	} else {
 		// 没有明确的过滤条件，尝试交互式选择
 		if len(streams) == 1 {
@@ -319,6 +368,20 @@ func runDownload(cmd *cobra.Command, url string) error {
 		}
 	}
 
+	// 缩略图流需要单独选择
+	for _, stream := range extractor.FilterImageStreams(streams, thumbnailSelect) {
+		selected := false
+		for _, s := range filteredStreams {
+			if s == stream {
+				selected = true
+				break
+			}
+		}
+		if !selected {
+			filteredStreams = append(filteredStreams, stream)
+		}
+	}
+
 	if len(filteredStreams) == 0 {
 		return fmt.Errorf("没有选择任何流进行下载")
 	}
@@ -329,6 +392,21 @@ func runDownload(cmd *cobra.Command, url string) error {
 		util.Logger.Warn(fmt.Sprintf("获取播放列表时出现警告: %v", err))
 	}
 
+	// 按SCTE-35等广告事件移除分片
+	if dropAdEvents {
+		util.CleanAdEvents(filteredStreams)
+	}
+
+	// 按Period过滤（DASH多Period）
+	var periodReg *regexp.Regexp
+	if selectPeriod != "" {
+		periodReg, err = regexp.Compile(selectPeriod)
+		if err != nil {
+			return fmt.Errorf("解析Period选择参数失败: %w", err)
+		}
+	}
+	util.FilterPeriods(filteredStreams, periodReg, dropAdPeriods)
+
 	util.Logger.Info(fmt.Sprintf("选择了 %d 个流进行下载", len(filteredStreams)))
 	util.Logger.Info("已选择的流:")
 	for _, stream := range filteredStreams {
@@ -351,6 +429,22 @@ func runDownload(cmd *cobra.Command, url string) error {
 		return fmt.Errorf("创建临时目录失败: %w", err)
 	}
 
+	// 解密密钥，格式为 KID:KEY 或 TRACK_ID:KEY
+	var decryptionKeys []string
+	for _, key := range keys {
+		if strings.TrimSpace(key) == "" {
+			continue
+		}
+		entry, err := util.ParseKeyPair(key)
+		if err != nil {
+			return fmt.Errorf("--key 参数无效: %w", err)
+		}
+		decryptionKeys = append(decryptionKeys, entry.String())
+	}
+	if keyTextFile != "" && !keyStoreAppend && !util.FileExists(keyTextFile) {
+		util.Logger.Warn("密钥文件不存在: %s", keyTextFile)
+	}
+
 	// 写出meta.json和meta_selected.json文件
 	if writeMetaJson {
 		if err := writeMetaJsonFiles(tmpDir, streams, filteredStreams); err != nil {
@@ -360,6 +454,18 @@ func runDownload(cmd *cobra.Command, url string) error {
 		}
 	}
 
+	// 只检查加密信息，不下载
+	if inspectEncryption {
+		report := util.InspectEncryption(filteredStreams, headers, encryptionKeyChecker(decryptionKeys, keyTextFile, keyContentID))
+		util.PrintEncryptionReport(report)
+		reportPath := filepath.Join(tmpDir, "encryption.json")
+		if err := util.WriteEncryptionReport(report, reportPath); err != nil {
+			return err
+		}
+		util.Logger.Info("已写入加密检查报告: %s", reportPath)
+		return nil
+	}
+
 	// 如果只是跳过下载，直接返回
 	if skipDownload {
 		util.Logger.Info("跳过下载，任务完成")
@@ -376,6 +482,34 @@ func runDownload(cmd *cobra.Command, url string) error {
 		util.Logger.Debug(fmt.Sprintf("自动查找到FFmpeg路径: %s", ffmpegPath))
 	}
 
+	// 解密引擎，NATIVE在进程内解密，不需要外部程序
+	decryptEngine = strings.ToUpper(strings.TrimSpace(decryptEngine))
+	if useShakaPackager {
+		decryptEngine = entity.DecryptEngineShaka.String()
+	}
+	switch decryptEngine {
+	case entity.DecryptEngineMP4Decrypt.String(), entity.DecryptEngineNative.String(), entity.DecryptEngineShaka.String():
+	default:
+		return fmt.Errorf("不支持的解密引擎: %s", decryptEngine)
+	}
+	if decryptionBinaryPath == "" && decryptEngine == entity.DecryptEngineMP4Decrypt.String() {
+		decryptionBinaryPath = mp4decryptBinaryPath
+		if decryptionBinaryPath == "" {
+			decryptionBinaryPath = util.FindExecutable("mp4decrypt")
+		}
+	}
+	if decryptionBinaryPath == "" && decryptEngine == entity.DecryptEngineShaka.String() {
+		decryptionBinaryPath = util.FindExecutable("packager")
+		if !util.FileExists(decryptionBinaryPath) {
+			decryptionBinaryPath = util.FindExecutable("shaka-packager")
+		}
+	}
+	// Shaka Packager无法单独处理不含样本的init或不含moov的分片，改为合并后整体解密
+	if decryptEngine == entity.DecryptEngineShaka.String() && mp4RealTimeDecryption {
+		util.Logger.Warn("Shaka Packager不支持实时解密，将在合并后解密")
+		mp4RealTimeDecryption = false
+	}
+
 	// 创建下载管理器配置
 	managerConfig := &downloader.ManagerConfig{
 		OutputDir:              outputDir,
@@ -398,6 +532,15 @@ func runDownload(cmd *cobra.Command, url string) error {
 		MuxAfterDone:           muxOptions != nil,          // 是否开启混流
 		MuxOptions:             muxOptions,                 // 混流选项
 		UseFFmpegConcatDemuxer: useFFmpegConcatDemuxer,
+		ThumbnailVTT:           thumbnailVTT,
+		DropAdEvents:           dropAdEvents,
+		DecryptionEngine:       decryptEngine,
+		DecryptionBinaryPath:   decryptionBinaryPath,
+		MP4RealTimeDecryption:  mp4RealTimeDecryption,
+		Keys:                   decryptionKeys,
+		KeyTextFile:            keyTextFile,
+		KeyContentID:           keyContentID,
+		KeyStoreAppend:         keyStoreAppend,
 	}
 
 	// 如果通过 -M 参数设置了muxOptions，则使用其中的MuxFormat
@@ -457,28 +600,33 @@ func init() {
 	rootCmd.PersistentFlags().String("max-speed", "", "最大下载速度")
 
 	// 流选择
-	rootCmd.PersistentFlags().StringP("select-video", "v", "best", "视频流选择")
+	rootCmd.PersistentFlags().StringP("select-video", "v", "best", "视频流选择，如 best、all、worst2 或 res=1920*:codecs=hvc1:for=best")
 	rootCmd.PersistentFlags().String("sv", "best", "视频流选择（简写）")
-	rootCmd.PersistentFlags().StringP("select-audio", "a", "best", "音频流选择")
+	rootCmd.PersistentFlags().StringP("select-audio", "a", "best", "音频流选择，如 lang=en:role=description:for=all")
 	rootCmd.PersistentFlags().String("sa", "best", "音频流选择（简写）")
-	rootCmd.PersistentFlags().StringP("select-subtitle", "s", "all", "字幕流选择")
+	rootCmd.PersistentFlags().StringP("select-subtitle", "s", "all", "字幕流选择，如 lang=\"zh|en\":characteristics=transcribes-spoken-dialog:for=all")
 	rootCmd.PersistentFlags().String("ss", "all", "字幕流选择（简写）")
-	rootCmd.PersistentFlags().String("drop-video", "", "排除视频轨道")
+	rootCmd.PersistentFlags().String("select-thumbnail", "", "缩略图流选择（best/worst/all），默认不下载")
+	rootCmd.PersistentFlags().Bool("thumbnail-vtt", false, "为缩略图生成WebVTT缩略图轨道（#xywh=）")
+	rootCmd.PersistentFlags().String("drop-video", "", "排除视频轨道，格式同--select-video")
 	rootCmd.PersistentFlags().String("dv", "", "排除视频轨道（简写）")
-	rootCmd.PersistentFlags().String("drop-audio", "", "排除音频轨道")
+	rootCmd.PersistentFlags().String("drop-audio", "", "排除音频轨道，格式同--select-audio")
 	rootCmd.PersistentFlags().String("da", "", "排除音频轨道（简写）")
-	rootCmd.PersistentFlags().String("drop-subtitle", "", "排除字幕轨道")
+	rootCmd.PersistentFlags().String("drop-subtitle", "", "排除字幕轨道，格式同--select-subtitle")
 	rootCmd.PersistentFlags().String("ds", "", "排除字幕轨道（简写）")
 
 	// 加密和解密
-	rootCmd.PersistentFlags().String("decrypt-engine", "MP4DECRYPT", "解密引擎")
-	rootCmd.PersistentFlags().StringSlice("key", []string{}, "解密密钥")
-	rootCmd.PersistentFlags().String("key-text-file", "", "密钥文本文件")
+	rootCmd.PersistentFlags().String("decrypt-engine", "MP4DECRYPT", "解密引擎: MP4DECRYPT, SHAKA, NATIVE")
+	rootCmd.PersistentFlags().StringSlice("key", []string{}, "解密密钥，格式为 KID:KEY 或 TRACK_ID:KEY")
+	rootCmd.PersistentFlags().String("key-text-file", "", "密钥文件，支持 KID:KEY 文本、JSON 和 CSV 格式")
+	rootCmd.PersistentFlags().String("key-content-id", "", "按内容ID筛选密钥文件中的密钥")
+	rootCmd.PersistentFlags().Bool("key-store-append", false, "将--key提供的新密钥追加到密钥文件")
+	rootCmd.PersistentFlags().Bool("inspect-encryption", false, "检查选中流的加密信息，输出表格并写出encryption.json，不下载")
 	rootCmd.PersistentFlags().Bool("mp4-real-time-decryption", false, "MP4实时解密")
 	rootCmd.PersistentFlags().Bool("use-shaka-packager", false, "使用Shaka Packager")
-	rootCmd.PersistentFlags().String("custom-hls-method", "", "自定义HLS加密方法")
-	rootCmd.PersistentFlags().String("custom-hls-key", "", "自定义HLS密钥")
-	rootCmd.PersistentFlags().String("custom-hls-iv", "", "自定义HLS初始向量")
+	rootCmd.PersistentFlags().String("custom-hls-method", "", "自定义HLS加密方法: AES_128, AES_128_ECB, AES_CTR, SAMPLE_AES, SAMPLE_AES_CTR, CENC, CBCS, CHACHA20, NONE")
+	rootCmd.PersistentFlags().String("custom-hls-key", "", "自定义HLS密钥，支持十六进制、base64或文件路径")
+	rootCmd.PersistentFlags().String("custom-hls-iv", "", "自定义HLS初始向量，支持十六进制、base64或文件路径")
 
 	// 混流和后处理
 	rootCmd.PersistentFlags().String("mux-format", "mp4", "混流格式")
@@ -494,6 +642,9 @@ func init() {
 	rootCmd.PersistentFlags().Bool("use-system-proxy", true, "使用系统代理")
 	rootCmd.PersistentFlags().String("custom-range", "", "自定义范围")
 	rootCmd.PersistentFlags().StringSlice("ad-keyword", []string{}, "广告关键词过滤")
+	rootCmd.PersistentFlags().String("select-period", "", "按PeriodID选择DASH Period（正则表达式）")
+	rootCmd.PersistentFlags().Bool("drop-ad-periods", false, "移除疑似广告的DASH Period")
+	rootCmd.PersistentFlags().Bool("drop-ad-events", false, "移除与SCTE-35广告事件（EventStream/emsg）重叠的分片")
 
 	// 直播相关
 	rootCmd.PersistentFlags().Bool("live-perform-as-vod", false, "直播当作点播处理")
@@ -509,6 +660,8 @@ func init() {
 	rootCmd.PersistentFlags().String("task-start-at", "", "任务开始时间")
 	rootCmd.PersistentFlags().StringSlice("url-processor", []string{}, "URL处理器")
 	rootCmd.PersistentFlags().String("url-processor-args", "", "URL处理器参数")
+	rootCmd.PersistentFlags().StringArray("key-processor", []string{}, "HLS密钥处理器，格式: 名称[:match=正则][:keyformat=xx][:xor=掩码]，可用: json:field=xx, hex, post:body=xx")
+	rootCmd.PersistentFlags().StringArray("content-processor", []string{}, "清单内容处理器，格式: 名称[:参数=值]，可用: json:path=xx, base64, hls-repair")
 	rootCmd.PersistentFlags().String("ffmpeg-binary-path", "", "FFmpeg二进制路径")
 	rootCmd.PersistentFlags().String("mp4decrypt-binary-path", "", "mp4decrypt二进制路径")
 	rootCmd.PersistentFlags().String("decryption-binary-path", "", "解密二进制路径")
@@ -542,6 +695,117 @@ func writeMetaJsonFiles(tmpDir string, allStreams, selectedStreams []*entity.Str
 	return nil
 }
 
+// sessionDataTitle 从EXT-X-SESSION-DATA中查找标题（DATA-ID以.title结尾）
+func sessionDataTitle(streams []*entity.StreamSpec) string {
+	for _, stream := range streams {
+		for _, data := range stream.SessionData {
+			if data.Value != "" && strings.HasSuffix(strings.ToLower(data.DataID), ".title") {
+				return data.Value
+			}
+		}
+	}
+	return ""
+}
+
+// encryptionKeyChecker 返回判断--key或密钥文件中是否有KID对应密钥的函数
+func encryptionKeyChecker(keys []string, keyTextFile, contentID string) func(kid string) bool {
+	var store *util.KeyStore
+	if keyTextFile != "" && util.FileExists(keyTextFile) {
+		loaded, err := util.LoadKeyStore(keyTextFile)
+		if err != nil {
+			util.Logger.Warn("加载密钥文件失败: %v", err)
+		}
+		store = loaded
+	}
+	return func(kid string) bool {
+		for _, key := range keys {
+			if parts := strings.SplitN(key, ":", 2); util.NormalizeKID(parts[0]) == kid {
+				return true
+			}
+		}
+		if store == nil {
+			return false
+		}
+		_, ok := store.Lookup(kid, contentID)
+		return ok
+	}
+}
+
+// parseCustomHLSEncryption 解析--custom-hls-method、--custom-hls-key和--custom-hls-iv
+func parseCustomHLSEncryption(methodStr, keyStr, ivStr string) (*entity.EncryptMethod, []byte, []byte, error) {
+	var method *entity.EncryptMethod
+	if methodStr != "" {
+		var m entity.EncryptMethod
+		normalized := strings.ReplaceAll(strings.ToUpper(strings.TrimSpace(methodStr)), "_", "-")
+		if err := m.UnmarshalJSON([]byte(normalized)); err != nil || m == entity.EncryptMethodUNKNOWN {
+			return nil, nil, nil, fmt.Errorf("不支持的加密方法: %s", methodStr)
+		}
+		method = &m
+	}
+
+	// CHACHA20使用32字节密钥和12字节nonce，其余方法均为16字节
+	keyLength, ivLength := 16, 16
+	if method != nil && *method == entity.EncryptMethodChacha20 {
+		keyLength, ivLength = 32, 12
+	}
+
+	var key, iv []byte
+	if keyStr != "" {
+		var err error
+		if key, err = parseCustomHLSBytes(keyStr); err != nil {
+			return nil, nil, nil, fmt.Errorf("--custom-hls-key 无效: %w", err)
+		}
+		if len(key) != keyLength {
+			return nil, nil, nil, fmt.Errorf("--custom-hls-key 长度应为%d字节，实际%d字节", keyLength, len(key))
+		}
+	}
+	if ivStr != "" {
+		var err error
+		if iv, err = parseCustomHLSBytes(ivStr); err != nil {
+			return nil, nil, nil, fmt.Errorf("--custom-hls-iv 无效: %w", err)
+		}
+		if len(iv) != ivLength {
+			return nil, nil, nil, fmt.Errorf("--custom-hls-iv 长度应为%d字节，实际%d字节", ivLength, len(iv))
+		}
+	}
+
+	util.Logger.Info("使用自定义HLS加密方法: %s", methodStr)
+	util.Logger.Debug("自定义HLS密钥=%s, IV=%s", hex.EncodeToString(key), hex.EncodeToString(iv))
+	return method, key, iv, nil
+}
+
+// parseCustomHLSBytes 解析十六进制（可带0x前缀）、base64或文件路径
+// 文件内容为十六进制或base64文本时按文本解码，否则按原始字节使用
+func parseCustomHLSBytes(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if util.FileExists(value) {
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("读取文件失败: %w", err)
+		}
+		if decoded, err := decodeHexOrBase64(strings.TrimSpace(string(data))); err == nil {
+			return decoded, nil
+		}
+		return data, nil
+	}
+	return decodeHexOrBase64(value)
+}
+
+// decodeHexOrBase64 先按十六进制解码，失败后按base64解码
+func decodeHexOrBase64(value string) ([]byte, error) {
+	hexStr := strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X")
+	if data, err := hex.DecodeString(hexStr); err == nil && len(data) > 0 {
+		return data, nil
+	}
+	if data, err := base64.StdEncoding.DecodeString(value); err == nil && len(data) > 0 {
+		return data, nil
+	}
+	if data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "=")); err == nil && len(data) > 0 {
+		return data, nil
+	}
+	return nil, fmt.Errorf("既不是十六进制也不是base64: %s", value)
+}
+
 // autoSelectStreams 自动选择流
 func autoSelectStreams(streams []*entity.StreamSpec) []*entity.StreamSpec {
 	var selected []*entity.StreamSpec
@@ -579,6 +843,119 @@ func selectStreamsInteractive(streams []*entity.StreamSpec) []*entity.StreamSpec
 	return util.SelectStreamsInteractive(streams)
 }
 
+// streamForReg 匹配 best、worst、bestN、worstN 和 all
+var streamForReg = regexp.MustCompile(`^(best|worst)\d*$|^all$`)
+
+// parseStreamFilter 解析流选择/排除条件，格式与C#版本一致
+// 如 best、all、worst2，或 lang="ja|en":codecs=mp4a:role=description:characteristics=describes-video:for=best
+// 为空或none时返回nil，表示不选择任何流（排除时表示不排除）
+func parseStreamFilter(input string) (*entity.StreamFilter, error) {
+	input = strings.TrimSpace(input)
+	if input == "" || strings.EqualFold(input, "none") {
+		return nil, nil
+	}
+
+	filter := &entity.StreamFilter{}
+	if streamForReg.MatchString(input) {
+		filter.For = input
+		return filter, nil
+	}
+
+	parser := util.NewComplexParamParser(input)
+	if len(parser.GetAllParams()) == 0 {
+		return nil, fmt.Errorf("无效的过滤条件: %s", input)
+	}
+
+	filter.For = "best"
+	if parser.HasKey("for") {
+		filter.For = parser.GetValue("for")
+		if !streamForReg.MatchString(filter.For) {
+			return nil, fmt.Errorf("for=%s 无效", filter.For)
+		}
+	}
+
+	regs := map[string]**regexp.Regexp{
+		"id":              &filter.GroupIdReg,
+		"lang":            &filter.LanguageReg,
+		"name":            &filter.NameReg,
+		"codecs":          &filter.CodecsReg,
+		"res":             &filter.ResolutionReg,
+		"frame":           &filter.FrameRateReg,
+		"channel":         &filter.ChannelsReg,
+		"range":           &filter.VideoRangeReg,
+		"characteristics": &filter.CharacteristicsReg,
+		"url":             &filter.UrlReg,
+	}
+	for key, target := range regs {
+		if !parser.HasKey(key) {
+			continue
+		}
+		reg, err := regexp.Compile(parser.GetValue(key))
+		if err != nil {
+			return nil, fmt.Errorf("%s的正则表达式无效: %w", key, err)
+		}
+		*target = reg
+	}
+
+	ints := map[string]**int64{
+		"segsMin": &filter.SegmentsMinCount,
+		"segsMax": &filter.SegmentsMaxCount,
+		"bwMin":   &filter.BandwidthMin,
+		"bwMax":   &filter.BandwidthMax,
+	}
+	for key, target := range ints {
+		if !parser.HasKey(key) {
+			continue
+		}
+		value, err := strconv.ParseInt(parser.GetValue(key), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s=%s 无效", key, parser.GetValue(key))
+		}
+		// 带宽以kbps指定
+		if strings.HasPrefix(key, "bw") {
+			value *= 1000
+		}
+		*target = &value
+	}
+
+	durs := map[string]**float64{
+		"plistDurMin": &filter.PlaylistMinDur,
+		"plistDurMax": &filter.PlaylistMaxDur,
+	}
+	for key, target := range durs {
+		if !parser.HasKey(key) {
+			continue
+		}
+		seconds, err := parseFilterSeconds(parser.GetValue(key))
+		if err != nil {
+			return nil, fmt.Errorf("%s=%s 无效", key, parser.GetValue(key))
+		}
+		*target = &seconds
+	}
+
+	if parser.HasKey("role") {
+		role, ok := entity.ParseRoleType(parser.GetValue("role"))
+		if !ok {
+			return nil, fmt.Errorf("role=%s 无效", parser.GetValue("role"))
+		}
+		filter.Role = &role
+	}
+
+	return filter, nil
+}
+
+// parseFilterSeconds 解析时长，支持秒数或 1h2m3s 形式
+func parseFilterSeconds(value string) (float64, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return seconds, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	return duration.Seconds(), nil
+}
+
 // parseMuxAfterDone 解析混流参数
 func parseMuxAfterDone(input string) (*entity.MuxOptions, error) {
 	parser := util.NewComplexParamParser(input)
@@ -643,6 +1020,7 @@ func parseMuxAfterDone(input string) (*entity.MuxOptions, error) {
 	skipSubtitle := skipSub == "true"
 
 	return &entity.MuxOptions{
+		Title:        parser.GetValue("title"),
 		UseMkvmerge:  useMkvmerge,
 		MuxFormat:    muxFormat,
 		KeepFiles:    keepFiles,
@@ -4,6 +4,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"fmt"
+	"io"
 )
 
 // pkcs7Unpad removes pkcs7 padding.
@@ -57,3 +58,176 @@ func AES128CBCDecrypt(encrypted, key, iv []byte) ([]byte, error) {
 
 	return unpadded, nil
 }
+
+// AESCTRDecrypt decrypts data using AES CTR mode. The IV is the initial 16-byte counter block.
+func AESCTRDecrypt(encrypted, key, iv []byte) ([]byte, error) {
+	stream, err := NewAESCTRStream(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	decrypted := make([]byte, len(encrypted))
+	stream.XORKeyStream(decrypted, encrypted)
+	return decrypted, nil
+}
+
+// NewAESCTRStream creates an AES CTR keystream that can decrypt data incrementally, chunk by chunk.
+func NewAESCTRStream(key, iv []byte) (cipher.Stream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("IV length must be %d bytes, got %d", aes.BlockSize, len(iv))
+	}
+
+	return cipher.NewCTR(block, iv), nil
+}
+
+// AESECBDecrypt decrypts data using AES ECB mode with PKCS7 padding.
+func AESECBDecrypt(encrypted, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	if len(encrypted)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted data is not a multiple of the block size (%d vs %d)", len(encrypted), aes.BlockSize)
+	}
+
+	decrypted := make([]byte, len(encrypted))
+	NewECBDecrypter(block).CryptBlocks(decrypted, encrypted)
+
+	// Same as CBC: segments without padding are returned as-is.
+	if unpadded, err := pkcs7Unpad(decrypted); err == nil {
+		return unpadded, nil
+	}
+	return decrypted, nil
+}
+
+// ecbDecrypter decrypts every block independently.
+type ecbDecrypter struct {
+	block cipher.Block
+}
+
+// NewECBDecrypter returns a BlockMode that decrypts in ECB mode. Like the CBC decrypter
+// from the standard library it can be fed any number of whole blocks at a time.
+func NewECBDecrypter(block cipher.Block) cipher.BlockMode {
+	return &ecbDecrypter{block: block}
+}
+
+func (e *ecbDecrypter) BlockSize() int {
+	return e.block.BlockSize()
+}
+
+func (e *ecbDecrypter) CryptBlocks(dst, src []byte) {
+	size := e.block.BlockSize()
+	if len(src)%size != 0 {
+		panic("crypto: input not full blocks")
+	}
+	if len(dst) < len(src) {
+		panic("crypto: output smaller than input")
+	}
+	for i := 0; i < len(src); i += size {
+		e.block.Decrypt(dst[i:i+size], src[i:i+size])
+	}
+}
+
+// NewAES128CBCDecryptWriter returns a writer that decrypts AES-128 CBC data into w as it is written.
+// Close must be called after the last write to flush the final block and strip PKCS7 padding.
+func NewAES128CBCDecryptWriter(w io.Writer, key, iv []byte) (io.WriteCloser, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("IV length must be %d bytes, got %d", aes.BlockSize, len(iv))
+	}
+
+	return &blockDecryptWriter{w: w, mode: cipher.NewCBCDecrypter(block, iv)}, nil
+}
+
+// NewAESECBDecryptWriter returns a writer that decrypts AES ECB data into w as it is written.
+// Close must be called after the last write to flush the final block and strip PKCS7 padding.
+func NewAESECBDecryptWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	return &blockDecryptWriter{w: w, mode: NewECBDecrypter(block)}, nil
+}
+
+// NewAESCTRDecryptWriter returns a writer that decrypts AES CTR data into w as it is written.
+func NewAESCTRDecryptWriter(w io.Writer, key, iv []byte) (io.WriteCloser, error) {
+	stream, err := NewAESCTRStream(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	return &streamDecryptWriter{w: w, stream: stream}, nil
+}
+
+// blockDecryptWriter decrypts whole blocks as they arrive. The last block is held back until
+// Close, because only then is it known to carry the padding.
+type blockDecryptWriter struct {
+	w       io.Writer
+	mode    cipher.BlockMode
+	pending []byte
+}
+
+func (b *blockDecryptWriter) Write(p []byte) (int, error) {
+	b.pending = append(b.pending, p...)
+
+	// Always keep between one byte and one full block pending.
+	size := b.mode.BlockSize()
+	n := (len(b.pending) - 1) / size * size
+	if n <= 0 {
+		return len(p), nil
+	}
+	b.mode.CryptBlocks(b.pending[:n], b.pending[:n])
+	if _, err := b.w.Write(b.pending[:n]); err != nil {
+		return 0, err
+	}
+	b.pending = append(b.pending[:0], b.pending[n:]...)
+	return len(p), nil
+}
+
+func (b *blockDecryptWriter) Close() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	if len(b.pending)%b.mode.BlockSize() != 0 {
+		return fmt.Errorf("encrypted data is not a multiple of the block size (%d trailing bytes)", len(b.pending))
+	}
+
+	b.mode.CryptBlocks(b.pending, b.pending)
+	last := b.pending
+	// Same as AES128CBCDecrypt: data without valid padding is written as-is.
+	if unpadded, err := pkcs7Unpad(last); err == nil {
+		last = unpadded
+	}
+	_, err := b.w.Write(last)
+	b.pending = nil
+	return err
+}
+
+// streamDecryptWriter XORs the keystream over each chunk before passing it on.
+type streamDecryptWriter struct {
+	w      io.Writer
+	stream cipher.Stream
+	buf    []byte
+}
+
+func (s *streamDecryptWriter) Write(p []byte) (int, error) {
+	if cap(s.buf) < len(p) {
+		s.buf = make([]byte, len(p))
+	}
+	buf := s.buf[:len(p)]
+	s.stream.XORKeyStream(buf, p)
+	return s.w.Write(buf)
+}
+
+func (s *streamDecryptWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,507 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	tsNullPID    = 0x1FFF
+)
+
+// Stream types of Sample-AES protected elementary streams and their clear equivalents.
+const (
+	streamTypeH264        = 0x1B
+	streamTypeAAC         = 0x0F
+	streamTypeAC3         = 0x81
+	streamTypeEAC3        = 0x87
+	streamTypeH264Sample  = 0xDB
+	streamTypeAACSample   = 0xCF
+	streamTypeAC3Sample   = 0xC1
+	streamTypeEAC3Sample  = 0xC2
+	sampleAESVideoLeader  = 32
+	sampleAESAudioLeader  = 16
+	sampleAESMinNALLength = 48
+	sampleAESSkipBytes    = 144
+)
+
+// sampleAESClearStreamType maps a Sample-AES stream type to the type of the decrypted stream.
+var sampleAESClearStreamType = map[byte]byte{
+	streamTypeH264Sample: streamTypeH264,
+	streamTypeAACSample:  streamTypeAAC,
+	streamTypeAC3Sample:  streamTypeAC3,
+	streamTypeEAC3Sample: streamTypeEAC3,
+}
+
+// tsPES is one PES packet together with the TS packets that carry it.
+type tsPES struct {
+	pid     uint16
+	packets []int
+	data    []byte
+}
+
+// SampleAESDecryptTS decrypts an MPEG-TS segment protected with HLS Sample Encryption (SAMPLE-AES).
+// H.264 slices use AES-128-CBC with a 1:9 block pattern after a 32 byte clear leader,
+// ADTS AAC and AC-3/E-AC-3 frames have a 16 byte clear leader followed by CBC encrypted blocks.
+// The CBC chain restarts with the key IV for every NAL unit and audio frame.
+// Emulation prevention bytes are removed from decrypted NAL units, so the stream is
+// repacketized and the PMT stream types are rewritten to their clear equivalents.
+func SampleAESDecryptTS(data, key, iv []byte) ([]byte, error) {
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("IV length must be %d bytes, got %d", aes.BlockSize, len(iv))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	if len(data) < tsPacketSize || data[0] != tsSyncByte {
+		return nil, fmt.Errorf("data is not an MPEG-TS stream")
+	}
+
+	out := make([]byte, len(data)/tsPacketSize*tsPacketSize)
+	copy(out, data)
+	packetCount := len(out) / tsPacketSize
+
+	pmtPIDs := make(map[uint16]bool)
+	streamTypes := make(map[uint16]byte)
+	open := make(map[uint16]*tsPES)
+	var finished []*tsPES
+
+	for i := 0; i < packetCount; i++ {
+		pkt := out[i*tsPacketSize : (i+1)*tsPacketSize]
+		if pkt[0] != tsSyncByte {
+			return nil, fmt.Errorf("lost TS sync at packet %d", i)
+		}
+		pid := uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2])
+		pusi := pkt[1]&0x40 != 0
+		payload := tsPayload(pkt)
+		if payload == nil {
+			continue
+		}
+
+		switch {
+		case pid == 0:
+			if pusi {
+				parsePAT(payload, pmtPIDs)
+			}
+		case pmtPIDs[pid]:
+			if pusi {
+				parsePMT(payload, streamTypes)
+			}
+		default:
+			if _, ok := streamTypes[pid]; !ok {
+				continue
+			}
+			if pusi {
+				if pes := open[pid]; pes != nil {
+					finished = append(finished, pes)
+				}
+				open[pid] = &tsPES{pid: pid}
+			}
+			pes := open[pid]
+			if pes == nil {
+				continue // payload continues a PES that started in an earlier segment
+			}
+			pes.packets = append(pes.packets, i)
+			pes.data = append(pes.data, payload...)
+		}
+	}
+	for _, pes := range open {
+		finished = append(finished, pes)
+	}
+
+	for _, pes := range finished {
+		decrypted, err := decryptPES(block, iv, streamTypes[pes.pid], pes.data)
+		if err != nil {
+			return nil, fmt.Errorf("PID %d: %w", pes.pid, err)
+		}
+		if err := repacketizePES(out, pes, decrypted); err != nil {
+			return nil, fmt.Errorf("PID %d: %w", pes.pid, err)
+		}
+	}
+
+	renumberContinuity(out, streamTypes)
+	for i := 0; i < packetCount; i++ {
+		pkt := out[i*tsPacketSize : (i+1)*tsPacketSize]
+		pid := uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2])
+		if pmtPIDs[pid] && pkt[1]&0x40 != 0 {
+			rewritePMTStreamTypes(pkt)
+		}
+	}
+	return out, nil
+}
+
+// tsPayload returns the payload of a TS packet, or nil if it carries none.
+func tsPayload(pkt []byte) []byte {
+	afc := (pkt[3] >> 4) & 0x03
+	offset := 4
+	if afc == 0x02 || afc == 0x00 {
+		return nil
+	}
+	if afc == 0x03 {
+		offset += 1 + int(pkt[4])
+	}
+	if offset >= tsPacketSize {
+		return nil
+	}
+	return pkt[offset:]
+}
+
+// psiSection returns the section following the pointer field of a PSI payload.
+func psiSection(payload []byte) []byte {
+	if len(payload) < 1 || int(payload[0])+1 >= len(payload) {
+		return nil
+	}
+	section := payload[1+int(payload[0]):]
+	if len(section) < 3 {
+		return nil
+	}
+	length := int(section[1]&0x0F)<<8 | int(section[2])
+	if 3+length > len(section) {
+		return nil
+	}
+	return section[:3+length]
+}
+
+func parsePAT(payload []byte, pmtPIDs map[uint16]bool) {
+	section := psiSection(payload)
+	if len(section) < 12 {
+		return
+	}
+	for pos := 8; pos+4 <= len(section)-4; pos += 4 {
+		program := uint16(section[pos])<<8 | uint16(section[pos+1])
+		pid := uint16(section[pos+2]&0x1F)<<8 | uint16(section[pos+3])
+		if program != 0 {
+			pmtPIDs[pid] = true
+		}
+	}
+}
+
+func parsePMT(payload []byte, streamTypes map[uint16]byte) {
+	section := psiSection(payload)
+	if len(section) < 16 {
+		return
+	}
+	programInfoLength := int(section[10]&0x0F)<<8 | int(section[11])
+	for pos := 12 + programInfoLength; pos+5 <= len(section)-4; {
+		streamType := section[pos]
+		pid := uint16(section[pos+1]&0x1F)<<8 | uint16(section[pos+2])
+		esInfoLength := int(section[pos+3]&0x0F)<<8 | int(section[pos+4])
+		switch streamType {
+		case streamTypeH264Sample, streamTypeAACSample, streamTypeAC3Sample, streamTypeEAC3Sample,
+			streamTypeH264, streamTypeAAC, streamTypeAC3, streamTypeEAC3:
+			streamTypes[pid] = streamType
+		}
+		pos += 5 + esInfoLength
+	}
+}
+
+// rewritePMTStreamTypes replaces Sample-AES stream types with clear ones and updates the section CRC.
+func rewritePMTStreamTypes(pkt []byte) {
+	payload := tsPayload(pkt)
+	section := psiSection(payload)
+	if len(section) < 16 {
+		return
+	}
+	changed := false
+	programInfoLength := int(section[10]&0x0F)<<8 | int(section[11])
+	for pos := 12 + programInfoLength; pos+5 <= len(section)-4; {
+		if clear, ok := sampleAESClearStreamType[section[pos]]; ok {
+			section[pos] = clear
+			changed = true
+		}
+		pos += 5 + (int(section[pos+3]&0x0F)<<8 | int(section[pos+4]))
+	}
+	if changed {
+		crc := mpegCRC32(section[:len(section)-4])
+		section[len(section)-4] = byte(crc >> 24)
+		section[len(section)-3] = byte(crc >> 16)
+		section[len(section)-2] = byte(crc >> 8)
+		section[len(section)-1] = byte(crc)
+	}
+}
+
+// mpegCRC32 computes the CRC-32/MPEG-2 checksum used by PSI sections.
+func mpegCRC32(data []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// decryptPES decrypts the elementary stream data of a PES packet and returns the new PES packet.
+func decryptPES(block cipher.Block, iv []byte, streamType byte, pes []byte) ([]byte, error) {
+	if len(pes) < 9 || pes[0] != 0 || pes[1] != 0 || pes[2] != 1 {
+		return nil, fmt.Errorf("invalid PES start code")
+	}
+	headerLength := 9 + int(pes[8])
+	if headerLength > len(pes) {
+		return nil, fmt.Errorf("invalid PES header length")
+	}
+	header := pes[:headerLength]
+	es := pes[headerLength:]
+
+	var decrypted []byte
+	switch streamType {
+	case streamTypeH264Sample, streamTypeH264:
+		decrypted = decryptH264ES(block, iv, es)
+	case streamTypeAACSample, streamTypeAAC:
+		decrypted = decryptADTSES(block, iv, es)
+	case streamTypeAC3Sample, streamTypeAC3, streamTypeEAC3Sample, streamTypeEAC3:
+		decrypted = decryptAC3ES(block, iv, es)
+	default:
+		return pes, nil
+	}
+
+	result := make([]byte, 0, len(header)+len(decrypted))
+	result = append(result, header...)
+	result = append(result, decrypted...)
+	if pes[4] != 0 || pes[5] != 0 {
+		length := len(result) - 6
+		result[4] = byte(length >> 8)
+		result[5] = byte(length)
+	}
+	return result, nil
+}
+
+// decryptH264ES decrypts the protected slices (NAL types 1 and 5) of an Annex B stream.
+func decryptH264ES(block cipher.Block, iv []byte, es []byte) []byte {
+	starts := findStartCodes(es)
+	if len(starts) == 0 {
+		return es
+	}
+	out := make([]byte, 0, len(es))
+	out = append(out, es[:starts[0]]...)
+	for i, start := range starts {
+		end := len(es)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		nal := es[start+3 : end]
+		// Zero bytes before the next start code belong to a 4-byte start code.
+		trimmed := bytes.TrimRight(nal, "\x00")
+		trailing := nal[len(trimmed):]
+
+		out = append(out, 0, 0, 1)
+		if len(trimmed) > sampleAESMinNALLength && (trimmed[0]&0x1F == 1 || trimmed[0]&0x1F == 5) {
+			out = append(out, decryptNALUnit(block, iv, trimmed)...)
+		} else {
+			out = append(out, trimmed...)
+		}
+		out = append(out, trailing...)
+	}
+	return out
+}
+
+// findStartCodes returns the offsets of all 0x000001 start codes.
+func findStartCodes(data []byte) []int {
+	var starts []int
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] == 0 && data[i+1] == 0 && data[i+2] == 1 {
+			starts = append(starts, i)
+			i += 2
+		}
+	}
+	return starts
+}
+
+// decryptNALUnit removes emulation prevention bytes and decrypts one block out of every ten.
+func decryptNALUnit(block cipher.Block, iv []byte, nal []byte) []byte {
+	unescaped := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		unescaped = append(unescaped, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+
+	mode := cipher.NewCBCDecrypter(block, iv)
+	data := unescaped[sampleAESVideoLeader:]
+	for len(data) > aes.BlockSize {
+		mode.CryptBlocks(data[:aes.BlockSize], data[:aes.BlockSize])
+		data = data[aes.BlockSize:]
+		data = data[min(sampleAESSkipBytes, len(data)):]
+	}
+	return unescaped
+}
+
+// decryptADTSES decrypts every ADTS frame of an AAC elementary stream.
+func decryptADTSES(block cipher.Block, iv []byte, es []byte) []byte {
+	for pos := 0; pos+7 <= len(es); {
+		if es[pos] != 0xFF || es[pos+1]&0xF0 != 0xF0 {
+			pos++
+			continue
+		}
+		headerLength := 7
+		if es[pos+1]&0x01 == 0 {
+			headerLength = 9 // CRC present
+		}
+		frameLength := int(es[pos+3]&0x03)<<11 | int(es[pos+4])<<3 | int(es[pos+5])>>5
+		if frameLength < headerLength || pos+frameLength > len(es) {
+			break
+		}
+		decryptAudioFrame(block, iv, es[pos+headerLength:pos+frameLength])
+		pos += frameLength
+	}
+	return es
+}
+
+// ac3Bitrates lists the nominal bitrates in kbit/s indexed by frmsizecod / 2.
+var ac3Bitrates = []int{32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 448, 512, 576, 640}
+
+// ac3FrameSize returns the size in bytes of the AC-3 or E-AC-3 frame starting at data.
+func ac3FrameSize(data []byte) int {
+	if len(data) < 6 || data[0] != 0x0B || data[1] != 0x77 {
+		return 0
+	}
+	if bsid := data[5] >> 3; bsid > 10 {
+		// E-AC-3: frmsiz is the frame size in 16-bit words minus one.
+		return ((int(data[2]&0x07)<<8 | int(data[3])) + 1) * 2
+	}
+	fscod := data[4] >> 6
+	frmsizecod := int(data[4] & 0x3F)
+	if frmsizecod/2 >= len(ac3Bitrates) {
+		return 0
+	}
+	bitrate := ac3Bitrates[frmsizecod/2]
+	switch fscod {
+	case 0: // 48 kHz
+		return bitrate * 4
+	case 1: // 44.1 kHz
+		return (bitrate*96000/44100 + (frmsizecod & 1)) * 2
+	case 2: // 32 kHz
+		return bitrate * 6
+	}
+	return 0
+}
+
+// decryptAC3ES decrypts every AC-3 or E-AC-3 sync frame of an elementary stream.
+func decryptAC3ES(block cipher.Block, iv []byte, es []byte) []byte {
+	for pos := 0; pos+6 <= len(es); {
+		size := ac3FrameSize(es[pos:])
+		if size == 0 {
+			pos++
+			continue
+		}
+		if pos+size > len(es) {
+			break
+		}
+		decryptAudioFrame(block, iv, es[pos:pos+size])
+		pos += size
+	}
+	return es
+}
+
+// decryptAudioFrame decrypts the whole blocks following the 16 byte clear leader of an audio frame.
+func decryptAudioFrame(block cipher.Block, iv []byte, frame []byte) {
+	if len(frame) <= sampleAESAudioLeader {
+		return
+	}
+	data := frame[sampleAESAudioLeader:]
+	n := len(data) / aes.BlockSize * aes.BlockSize
+	if n == 0 {
+		return
+	}
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data[:n], data[:n])
+}
+
+// repacketizePES writes a PES packet back into the TS packets that carried it.
+// The payload can only shrink, so the last packet is padded with adaptation field stuffing
+// and packets that are no longer needed become null packets.
+func repacketizePES(out []byte, pes *tsPES, data []byte) error {
+	if len(data) > len(pes.data) {
+		return fmt.Errorf("decrypted PES is larger than the original")
+	}
+	for _, index := range pes.packets {
+		pkt := out[index*tsPacketSize : (index+1)*tsPacketSize]
+		if len(data) == 0 {
+			writeNullPacket(pkt)
+			continue
+		}
+		capacity := len(tsPayload(pkt))
+		chunk := data[:min(capacity, len(data))]
+		data = data[len(chunk):]
+		writePayload(pkt, chunk)
+	}
+	return nil
+}
+
+// writePayload replaces the payload of a packet, extending its adaptation field with stuffing if needed.
+func writePayload(pkt []byte, payload []byte) {
+	var adaptation []byte
+	if afc := (pkt[3] >> 4) & 0x03; afc == 0x03 && pkt[4] > 0 {
+		adaptation = append(adaptation, pkt[5:5+int(pkt[4])]...)
+	}
+
+	stuffing := tsPacketSize - 4 - len(payload)
+	if stuffing == 0 {
+		pkt[3] = pkt[3]&0xCF | 0x10
+		copy(pkt[4:], payload)
+		return
+	}
+
+	fieldLength := stuffing - 1
+	field := make([]byte, 0, fieldLength)
+	if len(adaptation) > 0 {
+		field = append(field, adaptation...)
+	} else if fieldLength > 0 {
+		field = append(field, 0x00) // no adaptation field flags
+	}
+	for len(field) < fieldLength {
+		field = append(field, 0xFF)
+	}
+
+	pkt[3] = pkt[3]&0xCF | 0x30
+	pkt[4] = byte(fieldLength)
+	copy(pkt[5:], field)
+	copy(pkt[5+fieldLength:], payload)
+}
+
+func writeNullPacket(pkt []byte) {
+	pkt[0] = tsSyncByte
+	pkt[1] = byte(tsNullPID >> 8)
+	pkt[2] = byte(tsNullPID & 0xFF)
+	pkt[3] = 0x10
+	for i := 4; i < tsPacketSize; i++ {
+		pkt[i] = 0xFF
+	}
+}
+
+// renumberContinuity rewrites the continuity counters of the elementary streams after repacketizing.
+func renumberContinuity(out []byte, streamTypes map[uint16]byte) {
+	counters := make(map[uint16]byte)
+	started := make(map[uint16]bool)
+	for i := 0; i+tsPacketSize <= len(out); i += tsPacketSize {
+		pkt := out[i : i+tsPacketSize]
+		pid := uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2])
+		if _, ok := streamTypes[pid]; !ok || pkt[3]&0x10 == 0 {
+			continue
+		}
+		if !started[pid] {
+			// Keep the first counter so that consecutive segments stay continuous.
+			counters[pid] = pkt[3] & 0x0F
+			started[pid] = true
+		}
+		pkt[3] = pkt[3]&0xF0 | counters[pid]
+		counters[pid] = (counters[pid] + 1) & 0x0F
+	}
+}
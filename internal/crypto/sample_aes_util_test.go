@@ -0,0 +1,255 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+const (
+	testPMTPID   = 0x1000
+	testVideoPID = 0x100
+	testAudioPID = 0x101
+)
+
+var (
+	testSampleAESKey = mustHex("00112233445566778899aabbccddeeff")
+	testSampleAESIV  = mustHex("0f0e0d0c0b0a09080706050403020100")
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// testTSPacket builds one TS packet, padding a short payload with adaptation field stuffing.
+func testTSPacket(pid uint16, pusi bool, cc int, payload []byte) []byte {
+	b1 := byte(pid>>8) & 0x1F
+	if pusi {
+		b1 |= 0x40
+	}
+	pkt := []byte{tsSyncByte, b1, byte(pid)}
+	if stuffing := tsPacketSize - 4 - len(payload); stuffing > 0 {
+		pkt = append(pkt, 0x30|byte(cc&0x0F), byte(stuffing-1))
+		if stuffing > 1 {
+			pkt = append(pkt, 0x00)
+			pkt = append(pkt, bytes.Repeat([]byte{0xFF}, stuffing-2)...)
+		}
+	} else {
+		pkt = append(pkt, 0x10|byte(cc&0x0F))
+	}
+	return append(pkt, payload...)
+}
+
+// testTSPackets splits a PES packet into TS packets with consecutive continuity counters.
+func testTSPackets(pid uint16, cc int, pes []byte) [][]byte {
+	var packets [][]byte
+	for len(pes) > 0 {
+		chunk := pes[:min(len(pes), tsPacketSize-4)]
+		pes = pes[len(chunk):]
+		packets = append(packets, testTSPacket(pid, len(packets) == 0, cc+len(packets), chunk))
+	}
+	return packets
+}
+
+// testPSIPacket builds a PSI section with its CRC, padded with 0xFF.
+func testPSIPacket(pid uint16, tableID byte, body []byte) []byte {
+	length := len(body) + 4
+	section := append([]byte{tableID, 0xB0 | byte(length>>8), byte(length)}, body...)
+	section = binary.BigEndian.AppendUint32(section, mpegCRC32(section))
+	payload := append([]byte{0}, section...)
+	payload = append(payload, bytes.Repeat([]byte{0xFF}, tsPacketSize-4-len(payload))...)
+	return testTSPacket(pid, true, 0, payload)
+}
+
+func testPAT() []byte {
+	return testPSIPacket(0, 0x00, []byte{0x00, 0x01, 0xC1, 0x00, 0x00, 0x00, 0x01, 0xE0 | testPMTPID>>8, testPMTPID & 0xFF})
+}
+
+func testPMT(videoType, audioType byte) []byte {
+	return testPSIPacket(testPMTPID, 0x02, []byte{
+		0x00, 0x01, 0xC1, 0x00, 0x00,
+		0xE0 | testVideoPID>>8, testVideoPID & 0xFF, 0xF0, 0x00,
+		videoType, 0xE0 | testVideoPID>>8, testVideoPID & 0xFF, 0xF0, 0x00,
+		audioType, 0xE0 | testAudioPID>>8, testAudioPID & 0xFF, 0xF0, 0x00,
+	})
+}
+
+// testPES wraps an elementary stream in a PES packet with a PTS; video PES packets are unbounded.
+func testPES(streamID byte, es []byte) []byte {
+	pes := []byte{0x00, 0x00, 0x01, streamID, 0x00, 0x00, 0x80, 0x80, 0x05, 0x21, 0x00, 0x01, 0x00, 0x01}
+	pes = append(pes, es...)
+	if streamID != 0xE0 {
+		binary.BigEndian.PutUint16(pes[4:6], uint16(len(pes)-6))
+	}
+	return pes
+}
+
+// testEscapeNAL inserts emulation prevention bytes.
+func testEscapeNAL(nal []byte) []byte {
+	var out []byte
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b <= 0x03 {
+			out = append(out, 0x03)
+			zeros = 0
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// encryptTestNAL encrypts a slice NAL unit as specified by HLS Sample Encryption: a 32 byte
+// clear leader, then one 16 byte block out of every 160 in one CBC chain, the last 16 bytes or
+// fewer stay clear. Emulation prevention is applied after encryption.
+func encryptTestNAL(block cipher.Block, nal []byte) []byte {
+	out := append([]byte{}, nal...)
+	mode := cipher.NewCBCEncrypter(block, testSampleAESIV)
+	for pos := sampleAESVideoLeader; len(out)-pos > aes.BlockSize; pos += aes.BlockSize + sampleAESSkipBytes {
+		mode.CryptBlocks(out[pos:pos+aes.BlockSize], out[pos:pos+aes.BlockSize])
+	}
+	return testEscapeNAL(out)
+}
+
+// testADTSFrame builds an ADTS frame without CRC around an AAC payload.
+func testADTSFrame(payload []byte) []byte {
+	length := 7 + len(payload)
+	header := []byte{0xFF, 0xF1, 0x50, 0x80 | byte(length>>11)&0x03, byte(length >> 3), byte(length&0x07)<<5 | 0x1F, 0xFC}
+	return append(header, payload...)
+}
+
+// encryptTestADTSFrame encrypts the whole blocks after the 16 byte clear leader of the payload.
+func encryptTestADTSFrame(block cipher.Block, payload []byte) []byte {
+	out := append([]byte{}, payload...)
+	data := out[sampleAESAudioLeader:]
+	n := len(data) / aes.BlockSize * aes.BlockSize
+	cipher.NewCBCEncrypter(block, testSampleAESIV).CryptBlocks(data[:n], data[:n])
+	return testADTSFrame(out)
+}
+
+func testPattern(size int, mul, add byte) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i)*mul + add
+	}
+	return data
+}
+
+func TestMPEGCRC32(t *testing.T) {
+	// Check value of the CRC-32/MPEG-2 catalogue entry.
+	if got := mpegCRC32([]byte("123456789")); got != 0x0376E6E7 {
+		t.Errorf("mpegCRC32 = %08x, want 0376e6e7", got)
+	}
+}
+
+func TestSampleAESDecryptTS(t *testing.T) {
+	block, err := aes.NewCipher(testSampleAESKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aud := []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xF0}
+
+	// The clear leader contains 00 00 02, so the encrypted slice carries an emulation prevention byte.
+	slice := testPattern(250, 13, 0x65)
+	slice[0] = 0x65 // IDR slice
+	slice[8], slice[9], slice[10] = 0x00, 0x00, 0x02
+	encryptedSlice := encryptTestNAL(block, slice)
+
+	// Short slices and other NAL types are never encrypted.
+	shortSlice := append([]byte{0x00, 0x00, 0x01, 0x41}, bytes.Repeat([]byte{0x9A}, sampleAESMinNALLength-1)...)
+
+	// Size the filler so that the encrypted PES ends with a single byte in its third packet.
+	// Removing the emulation prevention byte then leaves that packet empty.
+	fillerSize := 2*(tsPacketSize-4) + 1 - 14 - len(aud) - 3 - len(encryptedSlice) - len(shortSlice)
+	if fillerSize < 5 {
+		t.Fatalf("filler size %d too small", fillerSize)
+	}
+	filler := append([]byte{0x00, 0x00, 0x01, 0x06}, bytes.Repeat([]byte{0x80}, fillerSize-4)...)
+
+	videoES := func(slice []byte) []byte {
+		es := append([]byte{}, aud...)
+		es = append(es, 0x00, 0x00, 0x01)
+		es = append(es, slice...)
+		es = append(es, shortSlice...)
+		return append(es, filler...)
+	}
+	encryptedVideo := testPES(0xE0, videoES(encryptedSlice))
+	clearVideo := testPES(0xE0, videoES(slice))
+	if len(encryptedVideo) != 2*(tsPacketSize-4)+1 || len(clearVideo) != 2*(tsPacketSize-4) {
+		t.Fatalf("unexpected PES sizes %d and %d", len(encryptedVideo), len(clearVideo))
+	}
+	nextVideo := testPES(0xE0, aud)
+
+	// Two ADTS frames with 8 and 2 byte clear tails after the encrypted blocks.
+	aac := [][]byte{testPattern(56, 5, 0x11), testPattern(50, 3, 0x22)}
+	encryptedAudio := testPES(0xC0, append(encryptTestADTSFrame(block, aac[0]), encryptTestADTSFrame(block, aac[1])...))
+	clearAudio := testPES(0xC0, append(testADTSFrame(aac[0]), testADTSFrame(aac[1])...))
+
+	encryptedVideoPackets := testTSPackets(testVideoPID, 7, encryptedVideo)
+	input := bytes.Join([][]byte{
+		testPAT(),
+		testPMT(streamTypeH264Sample, streamTypeAACSample),
+		encryptedVideoPackets[0],
+		testTSPackets(testAudioPID, 3, encryptedAudio)[0],
+		encryptedVideoPackets[1],
+		encryptedVideoPackets[2],
+		testTSPackets(testVideoPID, 10, nextVideo)[0],
+	}, nil)
+
+	nullPacket := append([]byte{tsSyncByte, 0x1F, 0xFF, 0x10}, bytes.Repeat([]byte{0xFF}, tsPacketSize-4)...)
+	clearVideoPackets := testTSPackets(testVideoPID, 7, clearVideo)
+	want := bytes.Join([][]byte{
+		testPAT(),
+		testPMT(streamTypeH264, streamTypeAAC),
+		clearVideoPackets[0],
+		testTSPackets(testAudioPID, 3, clearAudio)[0],
+		clearVideoPackets[1],
+		nullPacket,
+		// The continuity counter continues from the last packet still carrying the stream.
+		testTSPackets(testVideoPID, 9, nextVideo)[0],
+	}, nil)
+
+	got, err := SampleAESDecryptTS(input, testSampleAESKey, testSampleAESIV)
+	if err != nil {
+		t.Fatalf("SampleAESDecryptTS: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("output length = %d, want %d", len(got), len(want))
+	}
+	for i := 0; i < len(want); i += tsPacketSize {
+		if !bytes.Equal(got[i:i+tsPacketSize], want[i:i+tsPacketSize]) {
+			t.Errorf("packet %d mismatch\n got %x\nwant %x", i/tsPacketSize, got[i:i+tsPacketSize], want[i:i+tsPacketSize])
+		}
+	}
+}
+
+func TestSampleAESDecryptTSErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		iv   []byte
+	}{
+		{name: "short IV", data: testPAT(), iv: testSampleAESIV[:8]},
+		{name: "not a TS stream", data: make([]byte, tsPacketSize), iv: testSampleAESIV},
+		{name: "lost sync", data: append(testPAT(), make([]byte, tsPacketSize)...), iv: testSampleAESIV},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SampleAESDecryptTS(tt.data, testSampleAESKey, tt.iv); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
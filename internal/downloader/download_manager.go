@@ -20,7 +20,9 @@ type DownloadManager struct {
 	mu               sync.RWMutex
 	mergeWaitGroup   sync.WaitGroup
 	fileDictionaries map[*entity.StreamSpec]map[int]string
-	streamKIDs       map[*entity.StreamSpec]string // Store KID per stream
+	streamKIDs       map[*entity.StreamSpec]string                   // Store KID per stream
+	nativeDecrypt    map[*entity.StreamSpec]*util.NativeDecryptState // Init segment track defaults per stream for NATIVE decryption
+	keyStore         *util.KeyStore
 	validationFailed bool
 }
 
@@ -71,6 +73,10 @@ type ManagerConfig struct {
 	DecryptionBinaryPath   string
 	DecryptionEngine       string
 	KeyTextFile            string
+	KeyContentID           string // 密钥库中的内容ID，只使用属于该内容或未限定内容的密钥
+	KeyStoreAppend         bool   // 将--key提供的密钥追加到密钥文件
+	ThumbnailVTT           bool   // 为缩略图流生成WebVTT缩略图轨道
+	DropAdEvents           bool   // 移除与SCTE-35等广告事件重叠的分片
 }
 
 // NewDownloadManager creates a new DownloadManager.
@@ -103,10 +109,223 @@ func NewDownloadManager(config *ManagerConfig, streams []*entity.StreamSpec) *Do
 		outputFiles:      make([]*OutputFile, 0),
 		fileDictionaries: make(map[*entity.StreamSpec]map[int]string),
 		streamKIDs:       make(map[*entity.StreamSpec]string),
+		nativeDecrypt:    make(map[*entity.StreamSpec]*util.NativeDecryptState),
+		keyStore:         loadKeyStore(config),
 		validationFailed: false,
 	}
 }
 
+// loadKeyStore 加载一次密钥文件并按KID建立索引，开启追加时把--key提供的新密钥写回密钥文件
+func loadKeyStore(config *ManagerConfig) *util.KeyStore {
+	if config.KeyTextFile == "" {
+		return nil
+	}
+
+	var store *util.KeyStore
+	if util.FileExists(config.KeyTextFile) {
+		loaded, err := util.LoadKeyStore(config.KeyTextFile)
+		if err != nil {
+			util.Logger.Warn("加载密钥文件失败: %v", err)
+			return nil
+		}
+		store = loaded
+		util.Logger.Debug("已加载密钥文件 %s，共%d条密钥", config.KeyTextFile, len(store.Entries()))
+	} else if config.KeyStoreAppend {
+		store = util.NewKeyStore(config.KeyTextFile)
+	} else {
+		return nil
+	}
+
+	if config.KeyStoreAppend && len(config.Keys) > 0 {
+		var entries []*util.KeyEntry
+		for _, key := range config.Keys {
+			entry, err := util.ParseKeyPair(key)
+			if err != nil {
+				continue
+			}
+			entry.ContentID = config.KeyContentID
+			entries = append(entries, entry)
+		}
+		if added, err := store.Append(entries); err != nil {
+			util.Logger.Warn("追加密钥到密钥文件失败: %v", err)
+		} else if added > 0 {
+			util.Logger.Info("已将%d条新密钥追加到密钥文件 %s", added, config.KeyTextFile)
+		}
+	}
+	return store
+}
+
+// isCommonEncryptedStream 流是否使用CENC/CBCS加密
+func isCommonEncryptedStream(stream *entity.StreamSpec) bool {
+	if stream.Playlist == nil {
+		return false
+	}
+	if init := stream.Playlist.MediaInit; init != nil && init.EncryptInfo != nil && init.EncryptInfo.Method.IsCommonEncryption() {
+		return true
+	}
+	for _, seg := range stream.Playlist.GetAllSegments() {
+		if seg.EncryptInfo != nil && seg.EncryptInfo.Method.IsCommonEncryption() {
+			return true
+		}
+	}
+	return false
+}
+
+// nativeDecryptState 获取流的原生解密状态，初始化段的轨道信息在同一流的分片之间共享
+func (dm *DownloadManager) nativeDecryptState(stream *entity.StreamSpec) *util.NativeDecryptState {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	state := dm.nativeDecrypt[stream]
+	if state == nil {
+		state = &util.NativeDecryptState{}
+		dm.nativeDecrypt[stream] = state
+	}
+	return state
+}
+
+// decryptMergedFile 对合并后的文件整体解密，解密结果写入同目录的临时文件后原子替换原文件
+func (dm *DownloadManager) decryptMergedFile(filePath, kid string) error {
+	util.Logger.Info("正在对合并后的加密文件进行解密...")
+	var totalSize int64
+	if info, err := os.Stat(filePath); err == nil {
+		totalSize = info.Size()
+	}
+	decryptTask := util.UI.AddTask(util.TaskTypeDecrypt, filepath.Base(filePath), 1, totalSize)
+	// 保留扩展名，外部解密程序依据扩展名判断输出格式
+	decPath := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + "_dec" + filepath.Ext(filePath)
+
+	if success, err := util.Decrypt(dm.config.DecryptionEngine, dm.config.DecryptionBinaryPath, dm.config.Keys, filePath, decPath, kid, nil, decryptTask); !success {
+		os.Remove(decPath)
+		if err == nil {
+			err = fmt.Errorf("解密程序未成功退出")
+		}
+		return fmt.Errorf("合并后解密失败: %w", err)
+	}
+	if err := os.Rename(decPath, filePath); err != nil {
+		os.Remove(decPath)
+		err = fmt.Errorf("替换解密后文件失败: %w", err)
+		decryptTask.SetError(err)
+		return err
+	}
+	decryptTask.Update(1, totalSize) // Mark as complete
+	decryptTask.ProcessedCount = 1
+	return nil
+}
+
+// manifestKIDs 收集清单中声明的全部KID（default_KID以及各DRM系统的pssh/PlayReady头）
+func manifestKIDs(stream *entity.StreamSpec) []string {
+	var kids []string
+	add := func(kid string) {
+		if kid = util.NormalizeKID(kid); kid == "" {
+			return
+		}
+		for _, k := range kids {
+			if k == kid {
+				return
+			}
+		}
+		kids = append(kids, kid)
+	}
+	add(stream.DefaultKID)
+	for _, info := range stream.DRMInfos {
+		for _, kid := range info.KIDs {
+			add(kid)
+		}
+	}
+	return kids
+}
+
+// searchKeysForKIDs 为每个KID查找密钥，多KID的流需要全部密钥
+// 密钥文件中找不到的KID再向清单中声明的ClearKey许可证服务器请求
+func (dm *DownloadManager) searchKeysForKIDs(stream *entity.StreamSpec, kids []string) {
+	for _, kid := range kids {
+		dm.searchKeyForKID(kid)
+	}
+	dm.requestClearKeyLicense(stream, kids)
+}
+
+// requestClearKeyLicense 为缺少密钥的KID请求W3C ClearKey许可证
+func (dm *DownloadManager) requestClearKeyLicense(stream *entity.StreamSpec, kids []string) {
+	var licenseURL string
+	for _, info := range stream.DRMInfos {
+		if info.SystemID == util.ClearKeySystemID && info.LicenseURL != "" {
+			licenseURL = info.LicenseURL
+			break
+		}
+	}
+	if licenseURL == "" {
+		return
+	}
+
+	var missing []string
+	for _, kid := range kids {
+		if kid = util.NormalizeKID(kid); kid != "" && !dm.hasKeyForKID(kid) {
+			missing = append(missing, kid)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	util.Logger.Info("请求ClearKey许可证: %s", licenseURL)
+	keys, err := util.AcquireClearKeyLicense(licenseURL, missing, dm.config.Headers)
+	if err != nil {
+		util.Logger.Warn("%v", err)
+		return
+	}
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	for _, key := range keys {
+		util.Logger.Info("获取到ClearKey密钥: %s", key)
+		if !containsFold(dm.config.Keys, key) {
+			dm.config.Keys = append(dm.config.Keys, key)
+		}
+	}
+}
+
+// hasKeyForKID 密钥列表中是否已有该KID的密钥
+func (dm *DownloadManager) hasKeyForKID(kid string) bool {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	for _, key := range dm.config.Keys {
+		if parts := strings.SplitN(key, ":", 2); len(parts) == 2 && util.NormalizeKID(parts[0]) == kid {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold 忽略大小写判断切片中是否包含字符串
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchKeyForKID 从密钥文件中查找KID对应的密钥并加入密钥列表
+func (dm *DownloadManager) searchKeyForKID(kid string) {
+	if kid == "" {
+		return
+	}
+	if dm.keyStore == nil {
+		return
+	}
+	entry, ok := dm.keyStore.Lookup(kid, dm.config.KeyContentID)
+	if !ok {
+		return
+	}
+	util.Logger.Info("从密钥文件中找到KID %s", entry.KID)
+	key := entry.String()
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if !containsFold(dm.config.Keys, key) {
+		dm.config.Keys = append(dm.config.Keys, key)
+	}
+}
+
 // StartDownload starts the download process.
 func (dm *DownloadManager) StartDownload() error {
 	util.UI.Start()
@@ -151,6 +370,8 @@ func (dm *DownloadManager) StartDownload() error {
 	downloadWg.Wait()
 	dm.mergeWaitGroup.Wait()
 
+	dm.writeEventsSidecar()
+
 	if downloadError != nil {
 		// Error is already logged
 	}
@@ -306,13 +527,25 @@ func (dm *DownloadManager) downloadSingleStreamOnly(stream *entity.StreamSpec, t
 
 	util.Logger.InfoMarkUp("开始下载...%s", dm.getStreamShortDescription(stream))
 
-	var currentKID string
+	// 清单中已声明KID时，下载前即可查找密钥
+	currentKID := stream.DefaultKID
+	dm.searchKeysForKIDs(stream, manifestKIDs(stream))
 	var readInfo bool
 	speedContainer := task.GetSpeedContainer()
 	var overallAesDecryptTask *util.Task  // Task for the entire stream's AES-128 decryption
 	var overallCencDecryptTask *util.Task // Task for the entire stream's CENC decryption
 
-	if stream.Playlist.MediaInit != nil {
+	// MSS的初始化段只是占位，moov在下载第一个分片后生成
+	if stream.ExtractorType == entity.ExtractorTypeMSS && stream.Playlist.MediaInit != nil && stream.Playlist.MediaInit.URL == "" {
+		if !dm.config.BinaryMerge && (stream.MediaType == nil || *stream.MediaType != entity.MediaTypeSubtitles) {
+			dm.config.BinaryMerge = true
+			util.Logger.WarnMarkUp("检测到fMP4，自动开启二进制合并")
+		}
+		dm.mu.Lock()
+		dm.fileDictionaries[stream][-1] = filepath.Join(streamDir, "_init.mp4.tmp")
+		dm.mu.Unlock()
+		task.Increment(1)
+	} else if stream.Playlist.MediaInit != nil {
 		if !dm.config.BinaryMerge && (stream.MediaType == nil || *stream.MediaType != entity.MediaTypeSubtitles) {
 			dm.config.BinaryMerge = true
 			util.Logger.WarnMarkUp("检测到fMP4，自动开启二进制合并")
@@ -329,16 +562,18 @@ func (dm *DownloadManager) downloadSingleStreamOnly(stream *entity.StreamSpec, t
 		dm.mu.Unlock()
 		task.Increment(1)
 
-		mp4Info, _ := util.GetMP4Info(mp4InitFile)
-		currentKID = mp4Info.KID
-		if key, _ := util.SearchKeyFromFile(dm.config.KeyTextFile, currentKID); key != "" {
-			dm.config.Keys = append(dm.config.Keys, key)
+		if mp4Info, err := util.GetMP4Info(mp4InitFile); err == nil && mp4Info.KID != "" {
+			currentKID = mp4Info.KID
+			dm.searchKeysForKIDs(stream, mp4Info.KIDs)
+			if len(mp4Info.KIDs) > 1 {
+				util.Logger.Info("检测到多个KID: %s", strings.Join(mp4Info.KIDs, ", "))
+			}
 		}
 
 		// CENC decryption for init segment (if applicable)
 		// This still creates a temporary task for the init segment only, as it's a single operation.
 		// The overallCencDecryptTask is for the main segments.
-		if dm.config.MP4RealTimeDecryption && currentKID != "" && len(dm.config.Keys) > 0 && stream.Playlist.MediaInit.EncryptInfo != nil && stream.Playlist.MediaInit.EncryptInfo.Method == entity.EncryptMethodCENC {
+		if dm.config.MP4RealTimeDecryption && currentKID != "" && len(dm.config.Keys) > 0 && stream.Playlist.MediaInit.EncryptInfo != nil && stream.Playlist.MediaInit.EncryptInfo.Method.IsCommonEncryption() {
 			decPath := strings.Replace(mp4InitFile, ".tmp", "_dec.tmp", 1)
 			var segmentSize int64
 			if info, err := os.Stat(mp4InitFile); err == nil {
@@ -346,7 +581,7 @@ func (dm *DownloadManager) downloadSingleStreamOnly(stream *entity.StreamSpec, t
 			}
 			// Create a temporary task for this specific init segment CENC decryption
 			initCencDecryptTask := util.UI.AddTask(util.TaskTypeDecrypt, filepath.Base(mp4InitFile)+"(Init CENC)", 1, segmentSize)
-			if success, _ := util.Decrypt(dm.config.DecryptionEngine, dm.config.DecryptionBinaryPath, dm.config.Keys, mp4InitFile, decPath, currentKID, initCencDecryptTask); success {
+			if success, _ := util.Decrypt(dm.config.DecryptionEngine, dm.config.DecryptionBinaryPath, dm.config.Keys, mp4InitFile, decPath, currentKID, dm.nativeDecryptState(stream), initCencDecryptTask); success {
 				dm.mu.Lock()
 				dm.fileDictionaries[stream][-1] = decPath
 				dm.mu.Unlock()
@@ -370,7 +605,7 @@ func (dm *DownloadManager) downloadSingleStreamOnly(stream *entity.StreamSpec, t
 
 	if !dm.config.BinaryMerge {
 		for _, seg := range segments { // Check all segments, not just the remaining ones
-			if seg.EncryptInfo != nil && seg.EncryptInfo.Method == entity.EncryptMethodCENC {
+			if seg.EncryptInfo != nil && seg.EncryptInfo.Method.IsCommonEncryption() {
 				dm.config.BinaryMerge = true
 				util.Logger.WarnMarkUp("检测到CENC加密，自动开启二进制合并")
 				break
@@ -386,7 +621,7 @@ func (dm *DownloadManager) downloadSingleStreamOnly(stream *entity.StreamSpec, t
 		var totalAesEncryptedBytes int64
 		isStreamAesEncrypted := false
 		for _, seg := range stream.Playlist.GetAllSegments() { // Iterate all segments for accurate count
-			if seg.IsEncrypted && seg.EncryptInfo != nil && seg.EncryptInfo.Method == entity.EncryptMethodAES128 {
+			if seg.IsEncrypted && seg.EncryptInfo != nil && isAESSegmentEncryption(seg.EncryptInfo.Method) {
 				isStreamAesEncrypted = true
 				aesEncryptedSegmentsCount++
 				if seg.ExpectLength != nil {
@@ -407,7 +642,7 @@ func (dm *DownloadManager) downloadSingleStreamOnly(stream *entity.StreamSpec, t
 			var totalCencBytes int64
 			isStreamCencEncrypted := false
 			for _, seg := range stream.Playlist.GetAllSegments() { // Iterate all segments
-				if seg.IsEncrypted && seg.EncryptInfo != nil && seg.EncryptInfo.Method == entity.EncryptMethodCENC {
+				if seg.IsEncrypted && seg.EncryptInfo != nil && seg.EncryptInfo.Method.IsCommonEncryption() {
 					isStreamCencEncrypted = true
 					cencSegmentsCount++
 					if seg.ExpectLength != nil {
@@ -446,11 +681,10 @@ func (dm *DownloadManager) downloadSingleStreamOnly(stream *entity.StreamSpec, t
 
 		decryptedFilePath := downloadResult.FilePath
 		// Handle CENC decryption for the first segment if applicable, using overallCencDecryptTask
-		if dm.config.MP4RealTimeDecryption && currentKID == "" { // If KID wasn't from init, try to get it now
-			mp4Info, _ := util.GetMP4Info(downloadResult.FilePath)
-			currentKID = mp4Info.KID
-			if key, _ := util.SearchKeyFromFile(dm.config.KeyTextFile, currentKID); key != "" {
-				dm.config.Keys = append(dm.config.Keys, key)
+		if currentKID == "" { // If KID wasn't from init, try to get it now (also needed for post-merge decryption)
+			if mp4Info, err := util.GetMP4Info(downloadResult.FilePath); err == nil {
+				currentKID = mp4Info.KID
+				dm.searchKeysForKIDs(stream, mp4Info.KIDs)
 			}
 			// Re-evaluate overallCencDecryptTask creation if KID is now available and task not yet created
 			if overallCencDecryptTask == nil && dm.config.MP4RealTimeDecryption && currentKID != "" {
@@ -458,7 +692,7 @@ func (dm *DownloadManager) downloadSingleStreamOnly(stream *entity.StreamSpec, t
 				var totalCencBytes int64
 				isStreamCencEncrypted := false
 				for _, seg := range stream.Playlist.GetAllSegments() {
-					if seg.IsEncrypted && seg.EncryptInfo != nil && seg.EncryptInfo.Method == entity.EncryptMethodCENC {
+					if seg.IsEncrypted && seg.EncryptInfo != nil && seg.EncryptInfo.Method.IsCommonEncryption() {
 						isStreamCencEncrypted = true
 						cencSegmentsCount++
 						if seg.ExpectLength != nil {
@@ -475,9 +709,9 @@ func (dm *DownloadManager) downloadSingleStreamOnly(stream *entity.StreamSpec, t
 			}
 		}
 
-		if dm.config.MP4RealTimeDecryption && currentKID != "" && len(dm.config.Keys) > 0 && firstSegment.EncryptInfo != nil && firstSegment.EncryptInfo.Method == entity.EncryptMethodCENC {
+		if dm.config.MP4RealTimeDecryption && currentKID != "" && len(dm.config.Keys) > 0 && firstSegment.EncryptInfo != nil && firstSegment.EncryptInfo.Method.IsCommonEncryption() {
 			decPath := strings.Replace(downloadResult.FilePath, ".tmp", "_dec.tmp", 1)
-			if success, _ := util.Decrypt(dm.config.DecryptionEngine, dm.config.DecryptionBinaryPath, dm.config.Keys, downloadResult.FilePath, decPath, currentKID, overallCencDecryptTask); success {
+			if success, _ := util.Decrypt(dm.config.DecryptionEngine, dm.config.DecryptionBinaryPath, dm.config.Keys, downloadResult.FilePath, decPath, currentKID, dm.nativeDecryptState(stream), overallCencDecryptTask); success {
 				decryptedFilePath = decPath
 			} else {
 				if overallCencDecryptTask != nil { // Check if task exists
@@ -572,9 +806,9 @@ func (dm *DownloadManager) downloadSegments(segments []*entity.MediaSegment, out
 			downloadSegResult := dm.downloader.DownloadSegment(segment, segmentPath, speedContainer, dm.config.Headers, overallAesDecryptTask) // AES handled by simple downloader
 			if downloadSegResult != nil && downloadSegResult.Success {
 				decryptedFilePath := downloadSegResult.FilePath
-				if dm.config.MP4RealTimeDecryption && currentKID != "" && len(dm.config.Keys) > 0 && segment.EncryptInfo != nil && segment.EncryptInfo.Method == entity.EncryptMethodCENC {
+				if dm.config.MP4RealTimeDecryption && currentKID != "" && len(dm.config.Keys) > 0 && segment.EncryptInfo != nil && segment.EncryptInfo.Method.IsCommonEncryption() {
 					decPath := strings.Replace(downloadSegResult.FilePath, ".tmp", "_dec.tmp", 1)
-					if success, _ := util.Decrypt(dm.config.DecryptionEngine, dm.config.DecryptionBinaryPath, dm.config.Keys, downloadSegResult.FilePath, decPath, currentKID, overallCencDecryptTask); success {
+					if success, _ := util.Decrypt(dm.config.DecryptionEngine, dm.config.DecryptionBinaryPath, dm.config.Keys, downloadSegResult.FilePath, decPath, currentKID, dm.nativeDecryptState(stream), overallCencDecryptTask); success {
 						decryptedFilePath = decPath
 					} else {
 						if overallCencDecryptTask != nil {
@@ -623,9 +857,9 @@ func (dm *DownloadManager) downloadSegmentsConcurrently(segments []*entity.Media
 				downloadSegResult := dm.downloader.DownloadSegment(item.segment, segmentPath, speedContainer, dm.config.Headers, overallAesDecryptTask) // AES handled by simple downloader
 				if downloadSegResult != nil && downloadSegResult.Success {
 					decryptedFilePath := downloadSegResult.FilePath
-					if dm.config.MP4RealTimeDecryption && currentKID != "" && len(dm.config.Keys) > 0 && item.segment.EncryptInfo.Method == entity.EncryptMethodCENC {
+					if dm.config.MP4RealTimeDecryption && currentKID != "" && len(dm.config.Keys) > 0 && item.segment.EncryptInfo.Method.IsCommonEncryption() {
 						decPath := strings.Replace(downloadSegResult.FilePath, ".tmp", "_dec.tmp", 1)
-						if success, _ := util.Decrypt(dm.config.DecryptionEngine, dm.config.DecryptionBinaryPath, dm.config.Keys, downloadSegResult.FilePath, decPath, currentKID, overallCencDecryptTask); success {
+						if success, _ := util.Decrypt(dm.config.DecryptionEngine, dm.config.DecryptionBinaryPath, dm.config.Keys, downloadSegResult.FilePath, decPath, currentKID, dm.nativeDecryptState(stream), overallCencDecryptTask); success {
 							decryptedFilePath = decPath
 						} else {
 							if overallCencDecryptTask != nil {
@@ -759,6 +993,17 @@ func (dm *DownloadManager) mergeStreamInBackground(stream *entity.StreamSpec, re
 		return
 	}
 
+	// 缩略图不合并，直接导出图片
+	if stream.MediaType != nil && *stream.MediaType == entity.MediaTypeImages {
+		if err := dm.exportThumbnails(stream, task); err != nil {
+			util.Logger.Error("导出缩略图失败: %v", err)
+			dm.mu.Lock()
+			dm.validationFailed = true
+			dm.mu.Unlock()
+		}
+		return
+	}
+
 	outputPath := dm.getOutputPath(stream, task.ID)
 
 	// --- MERGE TASK & PROGRESS ---
@@ -846,25 +1091,16 @@ func (dm *DownloadManager) mergeStreamInBackground(stream *entity.StreamSpec, re
 		currentKID := dm.streamKIDs[stream]
 		dm.mu.RUnlock()
 
-		// Post-merge decryption is ONLY for CENC (KID-based) when not using real-time decryption.
+		// Post-merge decryption is ONLY for CENC/CBCS when not using real-time decryption.
 		// AES-128 is decrypted segment by segment in SimpleDownloader.
-		if !dm.config.MP4RealTimeDecryption && currentKID != "" && len(dm.config.Keys) > 0 && dm.config.DecryptionEngine == "MP4DECRYPT" {
-			util.Logger.Info("正在对合并后的CENC加密文件进行解密...")
-			var decryptTotalSize int64
-			if info, err := os.Stat(finalOutputPath); err == nil { // 使用 finalOutputPath
-				decryptTotalSize = info.Size()
-			}
-			decryptTask := util.UI.AddTask(util.TaskTypeDecrypt, filepath.Base(finalOutputPath), 1, decryptTotalSize)              // 使用 finalOutputPath
-			decPath := strings.TrimSuffix(finalOutputPath, filepath.Ext(finalOutputPath)) + "_dec" + filepath.Ext(finalOutputPath) // 使用 finalOutputPath
-
-			if success, _ := util.Decrypt(dm.config.DecryptionEngine, dm.config.DecryptionBinaryPath, dm.config.Keys, finalOutputPath, decPath, currentKID, decryptTask); success { // 使用 finalOutputPath
-				os.Remove(finalOutputPath)              // 使用 finalOutputPath
-				os.Rename(decPath, finalOutputPath)     // 使用 finalOutputPath
-				decryptTask.Update(1, decryptTotalSize) // Mark as complete
-				decryptTask.ProcessedCount = 1
-			} else {
+		if !dm.config.MP4RealTimeDecryption && len(dm.config.Keys) > 0 && (currentKID != "" || isCommonEncryptedStream(stream)) {
+			if err := dm.decryptMergedFile(finalOutputPath, currentKID); err != nil {
 				// Decryption failed, mark merge as failed too for consistency
-				mergeTask.SetError(fmt.Errorf("合并后CENC解密失败"))
+				util.Logger.Error(err.Error())
+				mergeTask.SetError(err)
+				dm.mu.Lock()
+				dm.validationFailed = true
+				dm.mu.Unlock()
 				return // Stop further processing
 			}
 		}
@@ -914,6 +1150,10 @@ func (dm *DownloadManager) postProcessStreamData(stream *entity.StreamSpec, resu
 		return fmt.Errorf(msg)
 	}
 
+	if len(stream.InbandEventSchemes) > 0 {
+		dm.extractInbandEvents(stream)
+	}
+
 	mediaType := entity.MediaTypeVideo
 	if stream.MediaType != nil {
 		mediaType = *stream.MediaType
@@ -1287,6 +1527,9 @@ func (dm *DownloadManager) getOutputExtension(stream *entity.StreamSpec) string
 		if *stream.MediaType == entity.MediaTypeSubtitles {
 			return "." + dm.config.SubtitleFormat
 		}
+		if *stream.MediaType == entity.MediaTypeImages {
+			return ".thumbnails"
+		}
 		if *stream.MediaType == entity.MediaTypeAudio && (stream.Extension == "m4s" || stream.Extension == "mp4") {
 			return ".m4a"
 		}
@@ -1394,13 +1637,13 @@ func (dm *DownloadManager) executeMux(inputs []*util.OutputFile, baseName string
 	}()
 
 	if dm.config.MuxOptions.UseMkvmerge {
-		err := util.MuxInputsByMkvmerge(dm.config.MkvmergePath, inputs, outputPath, workingDir)
+		err := util.MuxInputsByMkvmerge(dm.config.MkvmergePath, inputs, outputPath, dm.config.MuxOptions.Title, workingDir)
 		if err != nil {
 			util.Logger.Error("Mkvmerge混流失败: %+v", err)
 		}
 		currentMuxSuccess = err == nil
 	} else {
-		err := util.MuxInputsByFFmpeg(dm.config.FFmpegPath, inputs, outputPath, dm.config.MuxOptions.MuxFormat.String(), true, workingDir)
+		err := util.MuxInputsByFFmpeg(dm.config.FFmpegPath, inputs, outputPath, dm.config.MuxOptions.MuxFormat.String(), true, dm.config.MuxOptions.Title, workingDir)
 		if err != nil {
 			util.Logger.Error("FFmpeg混流失败: %+v", err)
 		}
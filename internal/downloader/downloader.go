@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"sync"
 
+	"N_m3u8DL-RE-GO/internal/crypto"
 	"N_m3u8DL-RE-GO/internal/entity"
 	"N_m3u8DL-RE-GO/internal/util"
 )
@@ -52,7 +53,13 @@ func (d *SegmentDownloader) DownloadSegment(segment *entity.MediaSegment, output
 	err := util.DoRetry(func() error {
 		util.Logger.Debug(fmt.Sprintf("正在下载段 %d: %s", segment.Index, segment.URL))
 
-		data, err := util.GetBytes(segment.URL, d.headers)
+		var data []byte
+		var err error
+		if segment.StartRange != nil {
+			data, err = util.GetBytesRange(segment.URL, d.headers, *segment.StartRange, segment.ExpectLength)
+		} else {
+			data, err = util.GetBytes(segment.URL, d.headers)
+		}
 		if err != nil {
 			return err
 		}
@@ -92,10 +99,11 @@ func (d *SegmentDownloader) decryptSegment(data []byte, encryptInfo *entity.Encr
 		return data, nil
 	}
 
-	// TODO: 实现各种解密算法
 	switch encryptInfo.Method {
 	case entity.EncryptMethodAES128:
 		return d.decryptAES128(data, encryptInfo)
+	case entity.EncryptMethodAES128ECB:
+		return d.decryptAESECB(data, encryptInfo)
 	case entity.EncryptMethodAESCTR:
 		return d.decryptAESCTR(data, encryptInfo)
 	case entity.EncryptMethodSampleAES:
@@ -107,23 +115,34 @@ func (d *SegmentDownloader) decryptSegment(data []byte, encryptInfo *entity.Encr
 
 // decryptAES128 解密AES-128
 func (d *SegmentDownloader) decryptAES128(data []byte, encryptInfo *entity.EncryptInfo) ([]byte, error) {
-	// TODO: 实现AES-128解密
-	util.Logger.Warn("AES-128解密尚未实现，返回原始数据")
-	return data, nil
+	if encryptInfo.Key == nil || encryptInfo.IV == nil {
+		return nil, fmt.Errorf("AES-128解密缺少密钥或IV")
+	}
+	return crypto.AES128CBCDecrypt(data, encryptInfo.Key, encryptInfo.IV)
 }
 
 // decryptAESCTR 解密AES-CTR
 func (d *SegmentDownloader) decryptAESCTR(data []byte, encryptInfo *entity.EncryptInfo) ([]byte, error) {
-	// TODO: 实现AES-CTR解密
-	util.Logger.Warn("AES-CTR解密尚未实现，返回原始数据")
-	return data, nil
+	if encryptInfo.Key == nil || encryptInfo.IV == nil {
+		return nil, fmt.Errorf("AES-CTR解密缺少密钥或IV")
+	}
+	return crypto.AESCTRDecrypt(data, encryptInfo.Key, encryptInfo.IV)
+}
+
+// decryptAESECB 解密AES-ECB
+func (d *SegmentDownloader) decryptAESECB(data []byte, encryptInfo *entity.EncryptInfo) ([]byte, error) {
+	if encryptInfo.Key == nil {
+		return nil, fmt.Errorf("AES-ECB解密缺少密钥")
+	}
+	return crypto.AESECBDecrypt(data, encryptInfo.Key)
 }
 
 // decryptSampleAES 解密Sample-AES
 func (d *SegmentDownloader) decryptSampleAES(data []byte, encryptInfo *entity.EncryptInfo) ([]byte, error) {
-	// TODO: 实现Sample-AES解密
-	util.Logger.Warn("Sample-AES解密尚未实现，返回原始数据")
-	return data, nil
+	if encryptInfo.Key == nil || encryptInfo.IV == nil {
+		return nil, fmt.Errorf("Sample-AES解密缺少密钥或IV")
+	}
+	return crypto.SampleAESDecryptTS(data, encryptInfo.Key, encryptInfo.IV)
 }
 
 // StreamDownloader 流下载器
@@ -0,0 +1,136 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"N_m3u8DL-RE-GO/internal/entity"
+	"N_m3u8DL-RE-GO/internal/util"
+)
+
+// emsg中表示时长未知的值
+const emsgUnknownDuration = 0xFFFFFFFF
+
+// extractInbandEvents 扫描已下载分片中的emsg事件
+// 开启DropAdEvents时同时移除与广告事件重叠的分片
+func (dm *DownloadManager) extractInbandEvents(stream *entity.StreamSpec) {
+	dm.mu.RLock()
+	fileDic := make(map[int]string, len(dm.fileDictionaries[stream]))
+	for index, path := range dm.fileDictionaries[stream] {
+		fileDic[index] = path
+	}
+	dm.mu.RUnlock()
+
+	var indices []int
+	for index := range fileDic {
+		if index >= 0 {
+			indices = append(indices, index)
+		}
+	}
+	sort.Ints(indices)
+
+	startTimes := util.SegmentStartTimes(stream.Playlist)
+	durations := make(map[int]float64)
+	parts := make(map[int]*entity.MediaPart)
+	for _, part := range stream.Playlist.MediaParts {
+		for _, segment := range part.MediaSegments {
+			durations[int(segment.Index)] = segment.Duration
+			parts[int(segment.Index)] = part
+		}
+	}
+
+	// 同一事件通常会在多个分片中重复出现
+	seen := make(map[string]bool)
+	var events []*entity.MediaEvent
+	for _, index := range indices {
+		data, err := os.ReadFile(fileDic[index])
+		if err != nil {
+			util.Logger.Warn("读取分片失败，跳过emsg扫描: %s", err.Error())
+			continue
+		}
+		for _, emsg := range util.ParseEmsgBoxes(data) {
+			if emsg.Timescale == 0 {
+				continue
+			}
+			key := fmt.Sprintf("%s|%s|%d", emsg.SchemeIDURI, emsg.Value, emsg.ID)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			timescale := float64(emsg.Timescale)
+			event := &entity.MediaEvent{
+				Source:      entity.EventSourceEmsg,
+				SchemeIDURI: emsg.SchemeIDURI,
+				Value:       emsg.Value,
+				ID:          strconv.FormatUint(uint64(emsg.ID), 10),
+				PeriodID:    stream.PeriodID,
+			}
+			if emsg.Version == 0 {
+				event.StartTime = startTimes[int64(index)] + float64(emsg.PresentationTimeDelta)/timescale
+			} else if part := parts[index]; part != nil {
+				// v1的时间为媒体时间，需与分片一样扣除presentationTimeOffset后加上Period起点
+				event.StartTime = part.PeriodStart + float64(emsg.PresentationTime)/timescale - part.PresentationTimeOffset
+			} else {
+				event.StartTime = float64(emsg.PresentationTime) / timescale
+			}
+			if emsg.EventDuration != emsgUnknownDuration {
+				event.Duration = float64(emsg.EventDuration) / timescale
+			}
+			util.ClassifyEvent(event, emsg.MessageData)
+			events = append(events, event)
+		}
+	}
+
+	if len(events) == 0 {
+		return
+	}
+	util.Logger.Info("从分片中提取到 %d 个emsg事件: %s", len(events), stream.ToShortString())
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	stream.Events = append(stream.Events, events...)
+
+	if !dm.config.DropAdEvents {
+		return
+	}
+	removed := 0
+	for _, index := range indices {
+		start := startTimes[int64(index)]
+		if util.AdBreakOverlaps(events, start, start+durations[index]) {
+			os.Remove(fileDic[index])
+			delete(dm.fileDictionaries[stream], index)
+			removed++
+		}
+	}
+	if removed > 0 {
+		util.Logger.Warn("按emsg广告事件移除了 %d 个分片", removed)
+	}
+}
+
+// writeEventsSidecar 写出所有流的事件到 <保存名>.events.json
+func (dm *DownloadManager) writeEventsSidecar() {
+	events := util.CollectEvents(dm.selectedStreams)
+	if len(events) == 0 {
+		return
+	}
+
+	saveDir := dm.config.SaveDir
+	if saveDir == "" {
+		saveDir = dm.config.OutputDir
+	}
+	fileName := "events.json"
+	if dm.config.SaveName != "" {
+		fileName = dm.sanitizeFileName(dm.config.SaveName) + ".events.json"
+	}
+	eventsPath := filepath.Join(saveDir, fileName)
+
+	if err := util.WriteEventsJSON(eventsPath, events); err != nil {
+		util.Logger.Warn("写入事件文件失败: %s", err.Error())
+		return
+	}
+	util.Logger.Info("已写入 %d 个事件: %s", len(events), eventsPath)
+}
@@ -1,7 +1,10 @@
 package downloader
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"time"
 
@@ -79,57 +82,56 @@ func (sd *SimpleDownloader) DownloadSegment(segment *entity.MediaSegment, output
 			return fmt.Errorf("创建目录失败: %w", err)
 		}
 
-		// 下载数据
-		data, err := util.GetBytes(segment.URL, mergedHeaders)
+		// 下载数据，带字节范围的分片只请求对应部分
+		var body io.ReadCloser
+		var err error
+		if segment.StartRange != nil {
+			body, err = util.GetStreamRange(segment.URL, mergedHeaders, *segment.StartRange, segment.ExpectLength)
+		} else {
+			body, err = util.GetStream(segment.URL, mergedHeaders)
+		}
 		if err != nil {
 			return err
 		}
+		defer body.Close()
 
-		// 更新速度统计
+		// 边读取边更新速度统计
+		var reader io.Reader = body
+		var counter *countingReader
 		if speedCounter != nil {
-			speedCounter.Add(int64(len(data)))
+			counter = &countingReader{reader: body, counter: speedCounter}
+			reader = counter
 		}
 
-		// 解密（如果需要）
-		if segment.IsEncrypted && segment.EncryptInfo != nil {
+		// 解密（如果需要），CENC/CBCS分段由下载管理器调用解密引擎处理
+		encryptInfo := segment.EncryptInfo
+		needDecrypt := segment.IsEncrypted && encryptInfo != nil && encryptInfo.IsEncrypted() && !encryptInfo.Method.IsCommonEncryption()
+		if needDecrypt {
 			util.Logger.Debug("分段 %d 需要解密，方法: %s, 密钥长度: %d, IV长度: %d",
-				segment.Index, segment.EncryptInfo.Method.String(),
-				len(segment.EncryptInfo.Key), len(segment.EncryptInfo.IV))
-
-			decryptedData, err := sd.decryptSegment(data, segment.EncryptInfo)
-			if err != nil {
-				if decryptTask != nil {
-					// Mark the overall decrypt task as error if one segment fails.
-					// Note: This might be too aggressive if some segments are fine.
-					// Consider if partial success is acceptable for decryption.
-					decryptTask.SetError(fmt.Errorf("分段 %d 解密失败: %w", segment.Index, err))
-				}
-				return fmt.Errorf("解密失败: %w", err)
-			}
-
-			util.Logger.Debug("分段 %d 解密完成，原始大小: %d, 解密后大小: %d",
-				segment.Index, len(data), len(decryptedData))
-
-			// 检查解密后的数据是否是有效的TS数据
-			if len(decryptedData) > 4 {
-				// TS包应该以0x47开头
-				if decryptedData[0] == 0x47 {
-					util.Logger.Debug("分段 %d 解密后数据格式正确 (TS包)", segment.Index)
-				} else {
-					util.Logger.Warn("分段 %d 解密后数据可能格式不正确，首字节: 0x%02x", segment.Index, decryptedData[0])
-				}
-			}
-
-			data = decryptedData
-			if decryptTask != nil {
-				decryptTask.GetSpeedContainer().Add(int64(len(data))) // Add decrypted size to speed counter
-			}
+				segment.Index, encryptInfo.Method.String(),
+				len(encryptInfo.Key), len(encryptInfo.IV))
 		}
 
-		// 写入文件
-		err = util.WriteFile(outputPath, data)
+		switch {
+		case !needDecrypt:
+			err = sd.writeStream(outputPath, reader, nil, nil)
+		case isAESSegmentEncryption(encryptInfo.Method):
+			err = sd.writeStream(outputPath, reader, encryptInfo, decryptTask)
+		default:
+			// ChaCha20按1024字节分块、Sample-AES需要解析整个TS，只能读入内存后解密
+			err = sd.writeDecrypted(outputPath, reader, encryptInfo, decryptTask)
+		}
 		if err != nil {
-			return fmt.Errorf("写入文件失败: %w", err)
+			// 失败的尝试已计入的字节撤回，重试时会重新计数
+			if counter != nil {
+				counter.rollback()
+			}
+			var decryptErr *segmentDecryptError
+			if decryptTask != nil && errors.As(err, &decryptErr) {
+				// Mark the overall decrypt task as error if one segment fails.
+				decryptTask.SetError(fmt.Errorf("分段 %d 解密失败: %w", segment.Index, decryptErr.err))
+			}
+			return err
 		}
 
 		util.Logger.Debug("分段 %d 下载完成", segment.Index)
@@ -138,10 +140,11 @@ func (sd *SimpleDownloader) DownloadSegment(segment *entity.MediaSegment, output
 
 	if err != nil {
 		result.Error = err
+		os.Remove(outputPath) // 不保留写了一半的文件
 		util.Logger.Error("分段 %d 下载失败: %s", segment.Index, err.Error())
 	} else {
 		result.Success = true
-		if decryptTask != nil && segment.IsEncrypted && segment.EncryptInfo != nil && segment.EncryptInfo.Method == entity.EncryptMethodAES128 {
+		if decryptTask != nil && segment.IsEncrypted && segment.EncryptInfo != nil && isAESSegmentEncryption(segment.EncryptInfo.Method) {
 			decryptTask.Increment(1) // Increment overall decrypt task
 		}
 	}
@@ -149,6 +152,142 @@ func (sd *SimpleDownloader) DownloadSegment(segment *entity.MediaSegment, output
 	return result
 }
 
+// segmentDecryptError 分段解密失败，区别于下载和写入失败
+type segmentDecryptError struct {
+	err error
+}
+
+func (e *segmentDecryptError) Error() string {
+	return fmt.Sprintf("解密失败: %v", e.err)
+}
+
+func (e *segmentDecryptError) Unwrap() error {
+	return e.err
+}
+
+// countingReader 每次读取后把读取的字节数计入速度统计
+type countingReader struct {
+	reader  io.Reader
+	counter SpeedCounter
+	counted int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.counter.Add(int64(n))
+		r.counted += int64(n)
+	}
+	return n, err
+}
+
+// rollback 从速度统计中撤回本次已计入的字节
+func (r *countingReader) rollback() {
+	r.counter.Add(-r.counted)
+	r.counted = 0
+}
+
+// countingWriter 每次写入后把写入的字节数计入速度统计
+type countingWriter struct {
+	writer  io.Writer
+	counter SpeedCounter
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.counter.Add(int64(n))
+	return n, err
+}
+
+// writeStream 把响应体直接写入文件，encryptInfo不为nil时边下载边解密（AES-CBC/CTR/ECB）
+func (sd *SimpleDownloader) writeStream(outputPath string, reader io.Reader, encryptInfo *entity.EncryptInfo, decryptTask *util.Task) error {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	defer file.Close()
+
+	var writer io.Writer = file
+	var decryptWriter io.WriteCloser
+	if encryptInfo != nil {
+		if decryptTask != nil {
+			writer = &countingWriter{writer: file, counter: decryptTask.GetSpeedContainer()}
+		}
+		decryptWriter, err = sd.newDecryptWriter(writer, encryptInfo)
+		if err != nil {
+			return &segmentDecryptError{err: err}
+		}
+		writer = decryptWriter
+	}
+
+	if _, err := io.Copy(writer, reader); err != nil {
+		return fmt.Errorf("下载分段数据失败: %w", err)
+	}
+	if decryptWriter != nil {
+		if err := decryptWriter.Close(); err != nil {
+			return &segmentDecryptError{err: err}
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	return nil
+}
+
+// writeDecrypted 读入整个分段解密后写入文件，用于无法分块解密的加密方式
+func (sd *SimpleDownloader) writeDecrypted(outputPath string, reader io.Reader, encryptInfo *entity.EncryptInfo, decryptTask *util.Task) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("下载分段数据失败: %w", err)
+	}
+
+	decryptedData, err := sd.decryptSegment(data, encryptInfo)
+	if err != nil {
+		return &segmentDecryptError{err: err}
+	}
+	if decryptTask != nil {
+		decryptTask.GetSpeedContainer().Add(int64(len(decryptedData))) // Add decrypted size to speed counter
+	}
+
+	if err := util.WriteFile(outputPath, decryptedData); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	return nil
+}
+
+// newDecryptWriter 创建分块解密的writer
+func (sd *SimpleDownloader) newDecryptWriter(w io.Writer, encryptInfo *entity.EncryptInfo) (io.WriteCloser, error) {
+	if encryptInfo.Key == nil {
+		return nil, fmt.Errorf("%s解密缺少密钥", encryptInfo.Method.String())
+	}
+
+	switch encryptInfo.Method {
+	case entity.EncryptMethodAES128:
+		if encryptInfo.IV == nil {
+			return nil, fmt.Errorf("AES-128解密缺少IV")
+		}
+		return crypto.NewAES128CBCDecryptWriter(w, encryptInfo.Key, encryptInfo.IV)
+	case entity.EncryptMethodAESCTR:
+		if encryptInfo.IV == nil {
+			return nil, fmt.Errorf("AES-CTR解密缺少IV")
+		}
+		return crypto.NewAESCTRDecryptWriter(w, encryptInfo.Key, encryptInfo.IV)
+	case entity.EncryptMethodAES128ECB:
+		return crypto.NewAESECBDecryptWriter(w, encryptInfo.Key)
+	default:
+		return nil, fmt.Errorf("不支持分块解密的加密方法: %s", encryptInfo.Method.String())
+	}
+}
+
+// isAESSegmentEncryption 是否为按整个分段解密的AES加密（CBC/CTR/ECB）
+func isAESSegmentEncryption(method entity.EncryptMethod) bool {
+	switch method {
+	case entity.EncryptMethodAES128, entity.EncryptMethodAESCTR, entity.EncryptMethodAES128ECB:
+		return true
+	}
+	return false
+}
+
 // decryptSegment 解密分段数据
 func (sd *SimpleDownloader) decryptSegment(data []byte, encryptInfo *entity.EncryptInfo) ([]byte, error) {
 	if encryptInfo.Method == entity.EncryptMethodNone {
@@ -166,8 +305,7 @@ func (sd *SimpleDownloader) decryptSegment(data []byte, encryptInfo *entity.Encr
 		return sd.decryptChaCha20(data, encryptInfo)
 	case entity.EncryptMethodSampleAES:
 		return sd.decryptSampleAES(data, encryptInfo)
-	case entity.EncryptMethodCENC:
-		util.Logger.Warn("CENC解密需要外部工具支持")
+	case entity.EncryptMethodCENC, entity.EncryptMethodCBCS:
 		return data, nil
 	default:
 		return nil, fmt.Errorf("不支持的加密方法: %s", encryptInfo.Method.String())
@@ -197,24 +335,16 @@ func (sd *SimpleDownloader) decryptAESCTR(data []byte, encryptInfo *entity.Encry
 		return nil, fmt.Errorf("AES-CTR解密缺少IV")
 	}
 
-	// TODO: Implement AES-CTR decryption if needed, for now, it might fall back or error.
-	// For HLS, CBC is the standard.
-	return nil, fmt.Errorf("AES-CTR decryption not yet fully implemented in crypto package for this path")
+	return crypto.AESCTRDecrypt(data, encryptInfo.Key, encryptInfo.IV)
 }
 
-// decryptAESECB 解密AES-ECB
+// decryptAESECB 解密AES-ECB，ECB模式不使用IV
 func (sd *SimpleDownloader) decryptAESECB(data []byte, encryptInfo *entity.EncryptInfo) ([]byte, error) {
 	if encryptInfo.Key == nil {
 		return nil, fmt.Errorf("AES-ECB解密缺少密钥")
 	}
 
-	if encryptInfo.IV == nil {
-		// ECB模式不需要IV，创建一个零IV
-		encryptInfo.IV = make([]byte, 16)
-	}
-
-	// TODO: Implement AES-ECB decryption if needed.
-	return nil, fmt.Errorf("AES-ECB decryption not yet fully implemented in crypto package for this path")
+	return crypto.AESECBDecrypt(data, encryptInfo.Key)
 }
 
 // decryptChaCha20 解密ChaCha20
@@ -233,8 +363,14 @@ func (sd *SimpleDownloader) decryptChaCha20(data []byte, encryptInfo *entity.Enc
 
 // decryptSampleAES 解密Sample-AES
 func (sd *SimpleDownloader) decryptSampleAES(data []byte, encryptInfo *entity.EncryptInfo) ([]byte, error) {
-	// Sample-AES是一种特殊的AES模式，通常用于音频/视频的部分加密
-	// 这里先用CTR模式作为替代实现
-	util.Logger.Warn("Sample-AES解密使用CTR模式替代实现")
-	return sd.decryptAESCTR(data, encryptInfo)
+	if encryptInfo.Key == nil {
+		return nil, fmt.Errorf("Sample-AES解密缺少密钥")
+	}
+
+	if encryptInfo.IV == nil {
+		return nil, fmt.Errorf("Sample-AES解密缺少IV")
+	}
+
+	// TS分段按HLS Sample Encryption规范解密H.264、AAC及AC-3样本，fMP4分段已按CBCS交由解密引擎处理
+	return crypto.SampleAESDecryptTS(data, encryptInfo.Key, encryptInfo.IV)
 }
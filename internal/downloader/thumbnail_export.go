@@ -0,0 +1,162 @@
+package downloader
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"N_m3u8DL-RE-GO/internal/entity"
+	"N_m3u8DL-RE-GO/internal/util"
+)
+
+// exportThumbnails 将下载的缩略图拼图移动到输出目录
+// 输出目录为 <保存名>.thumbnails，开启ThumbnailVTT时同时生成 <保存名>.thumbnails.vtt
+func (dm *DownloadManager) exportThumbnails(stream *entity.StreamSpec, task *util.Task) error {
+	outputDir := dm.getOutputPath(stream, task.ID)
+
+	dm.mu.RLock()
+	fileDic := make(map[int]string, len(dm.fileDictionaries[stream]))
+	for index, path := range dm.fileDictionaries[stream] {
+		fileDic[index] = path
+	}
+	dm.mu.RUnlock()
+
+	var indices []int
+	var totalSize int64
+	for index, path := range fileDic {
+		indices = append(indices, index)
+		if info, err := os.Stat(path); err == nil {
+			totalSize += info.Size()
+		}
+	}
+	sort.Ints(indices)
+
+	if err := util.CreateDir(outputDir); err != nil {
+		return fmt.Errorf("创建缩略图目录失败: %w", err)
+	}
+
+	ext := stream.Extension
+	if ext == "" {
+		ext = "jpg"
+	}
+	padLength := len(fmt.Sprintf("%d", len(indices)))
+	exportTask := util.UI.AddTask(util.TaskTypeMerge, dm.getStreamDescription(stream, task.ID), int64(len(indices)), totalSize)
+
+	files := make(map[int]string, len(indices))
+	for _, index := range indices {
+		target := filepath.Join(outputDir, fmt.Sprintf("%0*d.%s", padLength, index, ext))
+		if err := os.Rename(fileDic[index], target); err != nil {
+			exportTask.SetError(err)
+			return fmt.Errorf("移动缩略图失败: %w", err)
+		}
+		files[index] = target
+		exportTask.Increment(1)
+	}
+	util.Logger.Info("已导出 %d 张缩略图: %s", len(files), outputDir)
+
+	if dm.config.ThumbnailVTT {
+		vttPath := outputDir + ".vtt"
+		if err := dm.writeThumbnailVTT(stream, files, vttPath); err != nil {
+			return err
+		}
+		util.Logger.Info("已生成缩略图轨道: %s", vttPath)
+	}
+
+	return nil
+}
+
+// writeThumbnailVTT 生成WebVTT缩略图轨道，每个缩略图对应一条 #xywh= 定位的cue
+func (dm *DownloadManager) writeThumbnailVTT(stream *entity.StreamSpec, files map[int]string, vttPath string) error {
+	tile := entity.ThumbnailTile{Columns: 1, Rows: 1}
+	if stream.ThumbnailTile != nil {
+		tile = *stream.ThumbnailTile
+	}
+
+	segments := stream.Playlist.GetAllSegments()
+	if len(segments) == 0 {
+		return fmt.Errorf("缩略图流没有分片")
+	}
+
+	// 清单中未声明分辨率时，从图片本身读取
+	if tile.TileWidth <= 0 || tile.TileHeight <= 0 {
+		for _, segment := range segments {
+			if path, ok := files[int(segment.Index)]; ok {
+				width, height, err := imageSize(path)
+				if err != nil {
+					return fmt.Errorf("读取缩略图尺寸失败: %w", err)
+				}
+				tile.TileWidth = width / tile.Columns
+				tile.TileHeight = height / tile.Rows
+				break
+			}
+		}
+	}
+
+	// 按标称分片时长均分，最后一张图片可能不满
+	nominal := segments[0].Duration
+	for _, segment := range segments {
+		if segment.Duration > nominal {
+			nominal = segment.Duration
+		}
+	}
+	cellDuration := nominal / float64(tile.Count())
+
+	// 图片路径相对于vtt文件
+	dirName := filepath.Base(strings.TrimSuffix(vttPath, ".vtt"))
+	sub := &entity.WebVttSub{}
+	start := 0.0
+	for _, segment := range segments {
+		path, ok := files[int(segment.Index)]
+		if !ok {
+			start += segment.Duration
+			continue
+		}
+		end := start + segment.Duration
+		for i := 0; i < tile.Count(); i++ {
+			cellStart := start + float64(i)*cellDuration
+			if cellStart >= end {
+				break
+			}
+			cellEnd := cellStart + cellDuration
+			if cellEnd > end {
+				cellEnd = end
+			}
+			x := (i % tile.Columns) * tile.TileWidth
+			y := (i / tile.Columns) * tile.TileHeight
+			sub.Cues = append(sub.Cues, entity.SubCue{
+				StartTime: secondsToDuration(cellStart),
+				EndTime:   secondsToDuration(cellEnd),
+				Payload:   fmt.Sprintf("%s/%s#xywh=%d,%d,%d,%d", dirName, filepath.Base(path), x, y, tile.TileWidth, tile.TileHeight),
+			})
+		}
+		start = end
+	}
+
+	return util.WriteFile(vttPath, []byte(sub.ToVtt()))
+}
+
+// imageSize 读取图片尺寸
+func imageSize(path string) (int, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
+// secondsToDuration 秒转换为time.Duration，精确到毫秒
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds*1000+0.5) * time.Millisecond
+}
@@ -8,6 +8,17 @@ type EncryptInfo struct {
 	URI        string        `json:"URI,omitempty"`
 	KeyFormat  string        `json:"KeyFormat,omitempty"`
 	KeyFormatV string        `json:"KeyFormatVersions,omitempty"`
+	KID        string        `json:"KID,omitempty"`
+}
+
+// DRMInfo DRM保护系统信息
+type DRMInfo struct {
+	SystemID   string   `json:"SystemID"`
+	Name       string   `json:"Name,omitempty"`
+	PSSH       string   `json:"PSSH,omitempty"`       // base64编码的pssh box
+	PRO        string   `json:"PRO,omitempty"`        // base64编码的PlayReady Object
+	KIDs       []string `json:"KIDs,omitempty"`       // pssh或PlayReady头中声明的KID
+	LicenseURL string   `json:"LicenseURL,omitempty"` // 许可证服务器地址（dashif:Laurl）
 }
 
 // NewEncryptInfo 创建新的加密信息
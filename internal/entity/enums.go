@@ -1,5 +1,7 @@
 package entity
 
+import "strings"
+
 // MediaType 媒体类型枚举 - 重要修复：与C#版本保持一致的枚举值
 type MediaType int
 
@@ -8,6 +10,7 @@ const (
 	MediaTypeVideo          MediaType = 1  // 对应C# VIDEO = 1
 	MediaTypeSubtitles      MediaType = 2  // 对应C# SUBTITLES = 2
 	MediaTypeClosedCaptions MediaType = 3  // 对应C# CLOSED_CAPTIONS = 3
+	MediaTypeImages         MediaType = 4  // 缩略图（DASH thumbnail tile）
 	MediaTypeUnknown        MediaType = -1 // 未知类型
 )
 
@@ -21,6 +24,8 @@ func (m MediaType) String() string {
 		return "SUBTITLES"
 	case MediaTypeClosedCaptions:
 		return "CLOSED_CAPTIONS"
+	case MediaTypeImages:
+		return "IMAGES"
 	default:
 		return "UNKNOWN"
 	}
@@ -75,6 +80,11 @@ func (e EncryptMethod) String() string {
 	}
 }
 
+// IsCommonEncryption 是否为MP4通用加密（CENC/CBCS），这类分段由解密引擎处理
+func (e EncryptMethod) IsCommonEncryption() bool {
+	return e == EncryptMethodCENC || e == EncryptMethodCBCS
+}
+
 // MarshalJSON 实现JSON序列化
 func (e EncryptMethod) MarshalJSON() ([]byte, error) {
 	return []byte(`"` + e.String() + `"`), nil
@@ -189,6 +199,17 @@ func (r RoleType) String() string {
 	}
 }
 
+// ParseRoleType 按名称（不区分大小写）解析角色类型
+func ParseRoleType(name string) (RoleType, bool) {
+	name = strings.ReplaceAll(strings.TrimSpace(name), "-", "")
+	for role := RoleTypeMain; role <= RoleTypeDescription; role++ {
+		if strings.EqualFold(role.String(), name) {
+			return role, true
+		}
+	}
+	return RoleTypeNone, false
+}
+
 // Choice 选择枚举
 type Choice int
 
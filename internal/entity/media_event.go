@@ -0,0 +1,36 @@
+package entity
+
+// 事件来源
+const (
+	EventSourceMPD  = "mpd"
+	EventSourceEmsg = "emsg"
+)
+
+// 事件类型
+const (
+	EventTypeSCTE35 = "scte35"
+	EventTypeID3    = "id3"
+	EventTypeOther  = "other"
+)
+
+// MediaEvent 流中的定时事件（DASH EventStream 或 fMP4 emsg）
+type MediaEvent struct {
+	Source      string `json:"source"`
+	Type        string `json:"type"`
+	SchemeIDURI string `json:"schemeIdUri"`
+	Value       string `json:"value,omitempty"`
+	ID          string `json:"id,omitempty"`
+	PeriodID    string `json:"periodId,omitempty"`
+	// 展示时间和持续时间（秒）
+	StartTime float64 `json:"startTime"`
+	Duration  float64 `json:"duration,omitempty"`
+	// 是否为广告插入点
+	IsAdBreak bool `json:"isAdBreak,omitempty"`
+	// 消息内容，XML或文本原样保存，二进制数据为base64
+	Data string `json:"data,omitempty"`
+}
+
+// EndTime 事件结束时间
+func (e *MediaEvent) EndTime() float64 {
+	return e.StartTime + e.Duration
+}
@@ -3,6 +3,14 @@ package entity
 // MediaPart 媒体部分
 type MediaPart struct {
 	MediaSegments []*MediaSegment `json:"mediaSegments"`
+	// DASH多Period合并后，该部分所属的Period
+	PeriodID string `json:"periodId,omitempty"`
+	// 是否疑似广告Period
+	IsAd bool `json:"isAd,omitempty"`
+	// DASH中所属Period在演示时间轴上的起始时间（秒）
+	PeriodStart float64 `json:"periodStart,omitempty"`
+	// DASH中分片媒体时间相对Period起点的偏移（秒），即presentationTimeOffset
+	PresentationTimeOffset float64 `json:"presentationTimeOffset,omitempty"`
 }
 
 // NewMediaPart 创建新的媒体部分
@@ -17,6 +17,7 @@ type MediaSegment struct {
 	IsEncrypted  bool         `json:"IsEncrypted"`
 	URL          string       `json:"Url"`
 	NameFromVar  string       `json:"NameFromVar,omitempty"` // MPD分段文件名
+	StartTime    *float64     `json:"StartTime,omitempty"`   // 分片在演示时间轴上的起始时间（秒），DASH解析时确定
 }
 
 // NewMediaSegment 创建新的媒体段
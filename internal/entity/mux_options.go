@@ -9,6 +9,7 @@ type MuxOptions struct {
 	BinPath      string        `json:"binPath,omitempty"`
 	MuxerPath    string        `json:"muxerPath,omitempty"`
 	MuxImports   []*OutputFile `json:"muxImports,omitempty"` // 重要修复：添加MuxImports字段
+	Title        string        `json:"title,omitempty"`      // 混流输出的标题元数据
 }
 
 // OutputFile 输出文件
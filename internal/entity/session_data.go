@@ -0,0 +1,9 @@
+package entity
+
+// SessionData HLS主播放列表中的EXT-X-SESSION-DATA信息
+type SessionData struct {
+	DataID   string `json:"dataId"`
+	Value    string `json:"value,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	Language string `json:"language,omitempty"`
+}
@@ -60,6 +60,8 @@ type StreamSpec struct {
 	VideoRange string `json:"videoRange,omitempty"`
 	// 补充信息-特征
 	Characteristics string `json:"characteristics,omitempty"`
+	// 缩略图拼图信息（仅图片流）
+	ThumbnailTile *ThumbnailTile `json:"thumbnailTile,omitempty"`
 	// 发布时间（仅MPD需要）
 	PublishTime *time.Time `json:"publishTime,omitempty"`
 
@@ -70,6 +72,19 @@ type StreamSpec struct {
 
 	PeriodID string `json:"periodId,omitempty"`
 
+	// 清单中声明的默认KID和DRM系统信息
+	DefaultKID string     `json:"defaultKid,omitempty"`
+	DRMInfos   []*DRMInfo `json:"drmInfos,omitempty"`
+
+	// 清单中的EventStream以及分片内emsg事件
+	Events []*MediaEvent `json:"events,omitempty"`
+	// 声明了InbandEventStream的schemeIdUri，下载后需要扫描emsg
+	InbandEventSchemes []string `json:"inbandEventSchemes,omitempty"`
+
+	// HLS主播放列表中的会话级信息（EXT-X-SESSION-DATA / EXT-X-SESSION-KEY）
+	SessionData []*SessionData `json:"sessionData,omitempty"`
+	SessionKeys []*EncryptInfo `json:"sessionKeys,omitempty"`
+
 	// URL
 	URL         string `json:"url"`
 	OriginalURL string `json:"originalUrl"`
@@ -150,6 +165,23 @@ func (s *StreamSpec) ToShortString() string {
 			}
 			returnStr = strings.Join(parts, " | ")
 
+		case MediaTypeImages:
+			prefixStr = "[Img]"
+			parts := []string{}
+			if s.Resolution != "" {
+				parts = append(parts, s.Resolution)
+			}
+			if s.ThumbnailTile != nil {
+				parts = append(parts, s.ThumbnailTile.String())
+			}
+			if s.Bandwidth != nil {
+				parts = append(parts, fmt.Sprintf("%d Kbps", *s.Bandwidth/1000))
+			}
+			if s.GroupID != "" {
+				parts = append(parts, s.GroupID)
+			}
+			returnStr = strings.Join(parts, " | ")
+
 		default:
 			prefixStr = "[Vid]"
 			parts := []string{}
@@ -210,6 +242,11 @@ func (s *StreamSpec) ToString() string {
 		baseStr = "[*" + strings.Join(methodStrs, ",") + "] " + baseStr
 	}
 
+	// 添加KID信息
+	if s.DefaultKID != "" {
+		baseStr += " | KID:" + s.DefaultKID
+	}
+
 	// 计算时长
 	if s.Playlist != nil {
 		total := s.Playlist.GetTotalDuration()
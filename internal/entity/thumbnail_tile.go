@@ -0,0 +1,24 @@
+package entity
+
+import "fmt"
+
+// ThumbnailTile 缩略图拼图信息，每张图片按行优先排列 Columns x Rows 个缩略图
+type ThumbnailTile struct {
+	Columns    int `json:"columns"`
+	Rows       int `json:"rows"`
+	TileWidth  int `json:"tileWidth,omitempty"`
+	TileHeight int `json:"tileHeight,omitempty"`
+}
+
+// Count 每张图片包含的缩略图数量
+func (t *ThumbnailTile) Count() int {
+	return t.Columns * t.Rows
+}
+
+// String 转换为字符串表示
+func (t *ThumbnailTile) String() string {
+	if t.TileWidth > 0 && t.TileHeight > 0 {
+		return fmt.Sprintf("%dx%d Tiles (%dx%d)", t.Columns, t.Rows, t.TileWidth, t.TileHeight)
+	}
+	return fmt.Sprintf("%dx%d Tiles", t.Columns, t.Rows)
+}
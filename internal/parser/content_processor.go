@@ -0,0 +1,234 @@
+package parser
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"N_m3u8DL-RE-GO/internal/util"
+)
+
+// ContentProcessor 清单内容处理器
+// 在检测流类型和解析之前对获取到的原始内容进行改写
+type ContentProcessor interface {
+	// Name 处理器名称
+	Name() string
+	// CanProcess 判断是否需要处理该内容
+	CanProcess(content, url string) bool
+	// Process 处理内容，返回改写后的内容和URL（URL可能因为跳转而变化）
+	Process(content, url string, headers map[string]string) (string, string, error)
+}
+
+// NewContentProcessor 根据参数创建内容处理器
+// 格式: 名称[:参数=值[:参数=值]]，例如 "json:path=data.playUrl"、"base64"、"hls-repair"
+func NewContentProcessor(spec string) (ContentProcessor, error) {
+	name := strings.ToLower(strings.TrimSpace(strings.SplitN(spec, ":", 2)[0]))
+	params := util.NewComplexParamParser(spec)
+
+	switch name {
+	case "json":
+		path := params.GetValue("path")
+		if path == "" {
+			return nil, fmt.Errorf("json内容处理器缺少path参数")
+		}
+		return NewJSONPathContentProcessor(path), nil
+	case "base64":
+		return NewBase64ContentProcessor(), nil
+	case "hls-repair":
+		return NewHLSRepairContentProcessor(), nil
+	default:
+		return nil, fmt.Errorf("不支持的内容处理器: %s", name)
+	}
+}
+
+// JSONPathContentProcessor 从JSON响应中按路径提取清单内容
+// 提取结果如果是URL，则继续请求该URL获取真正的清单
+type JSONPathContentProcessor struct {
+	path []string
+}
+
+// NewJSONPathContentProcessor 创建JSON路径内容处理器
+// 路径使用点号分隔，数组下标可写作 list.0 或 list[0]
+func NewJSONPathContentProcessor(path string) *JSONPathContentProcessor {
+	return &JSONPathContentProcessor{path: parseJSONPath(path)}
+}
+
+var jsonIndexRegex = regexp.MustCompile(`\[(\d+)\]`)
+
+// parseJSONPath 将 data.list[0].url 形式的路径拆分为字段列表
+func parseJSONPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$.")
+	path = jsonIndexRegex.ReplaceAllString(path, ".$1")
+	var parts []string
+	for _, p := range strings.Split(path, ".") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// lookupJSONString 按路径在JSON数据中查找字符串值
+func lookupJSONString(data []byte, path []string) (string, error) {
+	var node interface{}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return "", fmt.Errorf("解析JSON失败: %w", err)
+	}
+
+	for _, key := range path {
+		switch v := node.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return "", fmt.Errorf("JSON中不存在字段: %s", key)
+			}
+			node = next
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return "", fmt.Errorf("JSON数组下标无效: %s", key)
+			}
+			node = v[idx]
+		default:
+			return "", fmt.Errorf("JSON路径无法继续解析: %s", key)
+		}
+	}
+
+	value, ok := node.(string)
+	if !ok {
+		return "", fmt.Errorf("JSON路径指向的值不是字符串")
+	}
+	return value, nil
+}
+
+// Name 处理器名称
+func (p *JSONPathContentProcessor) Name() string {
+	return "json"
+}
+
+// CanProcess 判断内容是否为JSON
+func (p *JSONPathContentProcessor) CanProcess(content, url string) bool {
+	trimmed := strings.TrimSpace(strings.TrimPrefix(content, "\ufeff"))
+	return strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")
+}
+
+// Process 按路径提取内容
+func (p *JSONPathContentProcessor) Process(content, url string, headers map[string]string) (string, string, error) {
+	value, err := lookupJSONString([]byte(strings.TrimPrefix(content, "\ufeff")), p.path)
+	if err != nil {
+		return content, url, err
+	}
+
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+		util.Logger.Debug("JSON路径提取到URL，继续请求: %s", value)
+		newContent, finalURL, err := util.GetStringAndURL(value, headers)
+		if err != nil {
+			return content, url, fmt.Errorf("获取JSON中的清单地址失败: %w", err)
+		}
+		return newContent, finalURL, nil
+	}
+
+	return value, url, nil
+}
+
+// Base64ContentProcessor 解码被base64编码的清单内容
+type Base64ContentProcessor struct{}
+
+// NewBase64ContentProcessor 创建base64内容处理器
+func NewBase64ContentProcessor() *Base64ContentProcessor {
+	return &Base64ContentProcessor{}
+}
+
+// Name 处理器名称
+func (p *Base64ContentProcessor) Name() string {
+	return "base64"
+}
+
+// CanProcess 判断内容是否为base64文本
+func (p *Base64ContentProcessor) CanProcess(content, url string) bool {
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "<") {
+		return false
+	}
+	return base64TextRegex.MatchString(trimmed)
+}
+
+var base64TextRegex = regexp.MustCompile(`^[A-Za-z0-9+/\-_\r\n]+={0,2}$`)
+
+// Process 解码base64内容
+func (p *Base64ContentProcessor) Process(content, url string, headers map[string]string) (string, string, error) {
+	trimmed := strings.NewReplacer("\r", "", "\n", "").Replace(strings.TrimSpace(content))
+
+	encodings := []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding,
+		base64.URLEncoding, base64.RawURLEncoding,
+	}
+	for _, enc := range encodings {
+		data, err := enc.DecodeString(trimmed)
+		if err != nil {
+			continue
+		}
+		if !utf8.Valid(data) {
+			return content, url, fmt.Errorf("base64解码结果不是有效的文本")
+		}
+		return string(data), url, nil
+	}
+
+	return content, url, fmt.Errorf("base64解码失败")
+}
+
+// HLSRepairContentProcessor 修复常见的HLS清单格式问题
+// 包括BOM、#EXTM3U之前的多余内容、CRLF换行以及行尾空白
+type HLSRepairContentProcessor struct{}
+
+// NewHLSRepairContentProcessor 创建HLS修复内容处理器
+func NewHLSRepairContentProcessor() *HLSRepairContentProcessor {
+	return &HLSRepairContentProcessor{}
+}
+
+// Name 处理器名称
+func (p *HLSRepairContentProcessor) Name() string {
+	return "hls-repair"
+}
+
+// CanProcess 判断内容是否为HLS清单，XML格式的DASH/MSS清单不处理
+func (p *HLSRepairContentProcessor) CanProcess(content, url string) bool {
+	if strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(content, "\ufeff")), "<") {
+		return false
+	}
+	return strings.Contains(strings.ToUpper(content), "#EXTM3U")
+}
+
+// Process 修复HLS清单
+func (p *HLSRepairContentProcessor) Process(content, url string, headers map[string]string) (string, string, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+
+	// 去除#EXTM3U之前的内容
+	if idx := strings.Index(strings.ToUpper(content), "#EXTM3U"); idx > 0 {
+		content = content[idx:]
+	}
+
+	lines := strings.Split(content, "\n")
+	var sb strings.Builder
+	for i, line := range lines {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "\ufeff"))
+		if i == 0 && len(line) >= len("#EXTM3U") && strings.EqualFold(line[:len("#EXTM3U")], "#EXTM3U") {
+			line = "#EXTM3U" + line[len("#EXTM3U"):]
+		}
+		// #EXTINF缺少逗号时补全
+		if strings.HasPrefix(line, "#EXTINF:") && !strings.Contains(line, ",") {
+			line += ","
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+
+	return sb.String(), url, nil
+}
@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"N_m3u8DL-RE-GO/internal/entity"
+	"N_m3u8DL-RE-GO/internal/util"
+)
+
+// 描述符的schemeIdUri
+const (
+	schemeDASHRole         = "urn:mpeg:dash:role:2011"
+	schemeTVAAudioPurpose  = "urn:tva:metadata:cs:AudioPurposeCS:2007"
+	schemeCEA608           = "urn:scte:dash:cc:cea-608:2015"
+	schemeCEA708           = "urn:scte:dash:cc:cea-708:2015"
+	schemeTrickMode        = "http://dashif.org/guidelines/trickmode"
+	schemeThumbnailTile    = "http://dashif.org/thumbnail_tile"
+	schemeThumbnailTileAlt = "http://dashif.org/guidelines/thumbnail_tile"
+)
+
+// 流特征，与HLS CHARACTERISTICS的取值保持一致，便于统一过滤
+const (
+	CharacteristicDescribesVideo    = "public.accessibility.describes-video"
+	CharacteristicTranscribesDialog = "public.accessibility.transcribes-spoken-dialog"
+	CharacteristicDescribesSound    = "public.accessibility.describes-music-and-sound"
+	CharacteristicEnhancesSpeech    = "public.accessibility.enhances-speech-intelligibility"
+	CharacteristicEasyToRead        = "public.easy-to-read"
+	CharacteristicTrickMode         = "trickmode"
+	// 缩略图拼图，值为 thumbnail-tile:列x行
+	CharacteristicThumbnailTile = "thumbnail-tile"
+)
+
+// parseDescriptors 解析Accessibility、Label、EssentialProperty和SupplementalProperty
+// 结果写入StreamSpec的Name、Characteristics和Role，Representation上的声明优先
+func (p *DASHParser) parseDescriptors(stream *entity.StreamSpec, repr Representation, adaptationSet AdaptationSet) {
+	// Label作为可读名称
+	if label := p.selectLabel(repr.Labels, stream.Language); label != "" {
+		stream.Name = label
+	} else if label := p.selectLabel(adaptationSet.Labels, stream.Language); label != "" {
+		stream.Name = label
+	}
+
+	var characteristics []string
+	addCharacteristic := func(values ...string) {
+		for _, value := range values {
+			if value == "" {
+				continue
+			}
+			exists := false
+			for _, c := range characteristics {
+				if c == value {
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				characteristics = append(characteristics, value)
+			}
+		}
+	}
+	setRole := func(role entity.RoleType) {
+		stream.Role = &role
+	}
+
+	isSubtitle := stream.MediaType != nil && *stream.MediaType == entity.MediaTypeSubtitles
+
+	accessibility := append(append([]Descriptor{}, adaptationSet.Accessibility...), repr.Accessibility...)
+	for _, desc := range accessibility {
+		value := strings.ToLower(strings.TrimSpace(desc.Value))
+		switch strings.ToLower(desc.SchemeIdUri) {
+		case schemeDASHRole:
+			switch value {
+			case "description":
+				addCharacteristic(CharacteristicDescribesVideo)
+				setRole(entity.RoleTypeDescription)
+			case "caption":
+				addCharacteristic(CharacteristicTranscribesDialog, CharacteristicDescribesSound)
+				setRole(entity.RoleTypeCaption)
+			case "sign":
+				setRole(entity.RoleTypeSign)
+			case "enhanced-audio-intelligibility":
+				addCharacteristic(CharacteristicEnhancesSpeech)
+			case "easyreader":
+				addCharacteristic(CharacteristicEasyToRead)
+			}
+		case strings.ToLower(schemeTVAAudioPurpose):
+			switch value {
+			case "1":
+				// 供视障人士使用的音频描述
+				addCharacteristic(CharacteristicDescribesVideo)
+				setRole(entity.RoleTypeDescription)
+			case "2":
+				// 供听障人士使用：字幕为SDH，音频为增强对白
+				if isSubtitle {
+					addCharacteristic(CharacteristicTranscribesDialog, CharacteristicDescribesSound)
+					setRole(entity.RoleTypeCaption)
+				} else {
+					addCharacteristic(CharacteristicEnhancesSpeech)
+				}
+			}
+		case schemeCEA608:
+			addCharacteristic("cea-608:" + desc.Value)
+		case schemeCEA708:
+			addCharacteristic("cea-708:" + desc.Value)
+		}
+	}
+
+	properties := append(append([]Descriptor{}, adaptationSet.EssentialProperty...), repr.EssentialProperty...)
+	properties = append(append(properties, adaptationSet.SupplementalProperty...), repr.SupplementalProperty...)
+	for _, desc := range properties {
+		switch strings.ToLower(desc.SchemeIdUri) {
+		case schemeTrickMode:
+			addCharacteristic(CharacteristicTrickMode)
+		case schemeThumbnailTile, schemeThumbnailTileAlt:
+			addCharacteristic(CharacteristicThumbnailTile + ":" + desc.Value)
+			stream.ThumbnailTile = p.parseThumbnailTile(desc.Value, repr.Width, repr.Height)
+		default:
+			util.Logger.Debug("忽略未识别的属性描述符: %s=%s", desc.SchemeIdUri, desc.Value)
+		}
+	}
+
+	if len(characteristics) > 0 {
+		stream.Characteristics = strings.Join(characteristics, ",")
+	}
+
+	// 未声明拼图的图片流视为每张图片一个缩略图
+	if stream.MediaType != nil && *stream.MediaType == entity.MediaTypeImages && stream.ThumbnailTile == nil {
+		stream.ThumbnailTile = &entity.ThumbnailTile{Columns: 1, Rows: 1, TileWidth: repr.Width, TileHeight: repr.Height}
+	}
+}
+
+// parseThumbnailTile 解析thumbnail_tile属性值，格式为 列x行
+func (p *DASHParser) parseThumbnailTile(value string, width, height int) *entity.ThumbnailTile {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(value)), "x")
+	if len(parts) != 2 {
+		return nil
+	}
+	columns, err1 := strconv.Atoi(parts[0])
+	rows, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || columns <= 0 || rows <= 0 {
+		util.Logger.Warn("无效的缩略图拼图参数: %s", value)
+		return nil
+	}
+
+	return &entity.ThumbnailTile{
+		Columns:    columns,
+		Rows:       rows,
+		TileWidth:  width / columns,
+		TileHeight: height / rows,
+	}
+}
+
+// selectLabel 选择Label，优先使用与流语言一致的
+func (p *DASHParser) selectLabel(labels []Label, lang string) string {
+	var first string
+	for _, label := range labels {
+		value := strings.TrimSpace(label.Value)
+		if value == "" {
+			continue
+		}
+		if lang != "" && strings.EqualFold(p.filterLanguage(label.Lang), lang) {
+			return value
+		}
+		if first == "" {
+			first = value
+		}
+	}
+	return first
+}
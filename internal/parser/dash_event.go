@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"N_m3u8DL-RE-GO/internal/entity"
+	"N_m3u8DL-RE-GO/internal/util"
+)
+
+// parseEventStreams 解析Period中的EventStream
+// periodStart为Period的起始时间（秒），事件时间换算为整个节目的展示时间
+func (p *DASHParser) parseEventStreams(period Period, periodStart float64) []*entity.MediaEvent {
+	var events []*entity.MediaEvent
+	for _, eventStream := range period.EventStreams {
+		timescale := 1.0
+		if eventStream.Timescale != "" {
+			if ts, err := strconv.ParseFloat(eventStream.Timescale, 64); err == nil && ts > 0 {
+				timescale = ts
+			}
+		}
+		var offset float64
+		if eventStream.PresentationTimeOffset != "" {
+			offset, _ = strconv.ParseFloat(eventStream.PresentationTimeOffset, 64)
+		}
+
+		for _, ev := range eventStream.Events {
+			var presentationTime, duration float64
+			if ev.PresentationTime != "" {
+				presentationTime, _ = strconv.ParseFloat(ev.PresentationTime, 64)
+			}
+			if ev.Duration != "" {
+				duration, _ = strconv.ParseFloat(ev.Duration, 64)
+			}
+
+			event := &entity.MediaEvent{
+				Source:      entity.EventSourceMPD,
+				SchemeIDURI: eventStream.SchemeIdUri,
+				Value:       eventStream.Value,
+				ID:          ev.ID,
+				PeriodID:    period.ID,
+				StartTime:   periodStart + (presentationTime-offset)/timescale,
+				Duration:    duration / timescale,
+			}
+
+			data := ev.MessageData
+			if data == "" {
+				data = strings.TrimSpace(ev.Content)
+			}
+			util.ClassifyEvent(event, []byte(data))
+			events = append(events, event)
+		}
+	}
+
+	if len(events) > 0 {
+		util.Logger.Debug("Period %s 中解析到 %d 个事件", period.ID, len(events))
+	}
+	return events
+}
@@ -19,6 +19,7 @@ type DASHParser struct {
 	mpdURL     string
 	baseURL    string
 	mpdContent string
+	headers    map[string]string
 }
 
 // MPD XML结构定义
@@ -35,13 +36,19 @@ type MPD struct {
 }
 
 type Period struct {
+	Href           string          `xml:"http://www.w3.org/1999/xlink href,attr"`
+	Actuate        string          `xml:"http://www.w3.org/1999/xlink actuate,attr"`
 	ID             string          `xml:"id,attr"`
+	Start          string          `xml:"start,attr"`
 	Duration       string          `xml:"duration,attr"`
 	BaseURL        string          `xml:"BaseURL"`
+	EventStreams   []EventStream   `xml:"EventStream"`
 	AdaptationSets []AdaptationSet `xml:"AdaptationSet"`
 }
 
 type AdaptationSet struct {
+	Href                      string                    `xml:"http://www.w3.org/1999/xlink href,attr"`
+	Actuate                   string                    `xml:"http://www.w3.org/1999/xlink actuate,attr"`
 	ContentType               string                    `xml:"contentType,attr"`
 	MimeType                  string                    `xml:"mimeType,attr"`
 	FrameRate                 string                    `xml:"frameRate,attr"`
@@ -49,7 +56,13 @@ type AdaptationSet struct {
 	Codecs                    string                    `xml:"codecs,attr"`
 	BaseURL                   string                    `xml:"BaseURL"`
 	Role                      Role                      `xml:"Role"`
+	Accessibility             []Descriptor              `xml:"Accessibility"`
+	Labels                    []Label                   `xml:"Label"`
+	EssentialProperty         []Descriptor              `xml:"EssentialProperty"`
+	SupplementalProperty      []Descriptor              `xml:"SupplementalProperty"`
+	InbandEventStreams        []Descriptor              `xml:"InbandEventStream"`
 	Representations           []Representation          `xml:"Representation"`
+	SegmentBase               SegmentBase               `xml:"SegmentBase"`
 	SegmentTemplate           SegmentTemplate           `xml:"SegmentTemplate"`
 	AudioChannelConfiguration AudioChannelConfiguration `xml:"AudioChannelConfiguration"`
 	ContentProtection         []ContentProtection       `xml:"ContentProtection"`
@@ -67,6 +80,11 @@ type Representation struct {
 	VolumeAdjust              string                    `xml:"volumeAdjust,attr"`
 	BaseURL                   string                    `xml:"BaseURL"`
 	Role                      Role                      `xml:"Role"`
+	Accessibility             []Descriptor              `xml:"Accessibility"`
+	Labels                    []Label                   `xml:"Label"`
+	EssentialProperty         []Descriptor              `xml:"EssentialProperty"`
+	SupplementalProperty      []Descriptor              `xml:"SupplementalProperty"`
+	InbandEventStreams        []Descriptor              `xml:"InbandEventStream"`
 	SegmentBase               SegmentBase               `xml:"SegmentBase"`
 	SegmentList               SegmentList               `xml:"SegmentList"`
 	SegmentTemplate           SegmentTemplate           `xml:"SegmentTemplate"`
@@ -78,15 +96,46 @@ type Role struct {
 	Value string `xml:"value,attr"`
 }
 
+// Descriptor 通用描述符（Accessibility、EssentialProperty、SupplementalProperty）
+type Descriptor struct {
+	SchemeIdUri string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type EventStream struct {
+	SchemeIdUri            string  `xml:"schemeIdUri,attr"`
+	Value                  string  `xml:"value,attr"`
+	Timescale              string  `xml:"timescale,attr"`
+	PresentationTimeOffset string  `xml:"presentationTimeOffset,attr"`
+	Events                 []Event `xml:"Event"`
+}
+
+type Event struct {
+	PresentationTime string `xml:"presentationTime,attr"`
+	Duration         string `xml:"duration,attr"`
+	ID               string `xml:"id,attr"`
+	MessageData      string `xml:"messageData,attr"`
+	Content          string `xml:",innerxml"`
+}
+
+type Label struct {
+	Lang  string `xml:"lang,attr"`
+	Value string `xml:",chardata"`
+}
+
 type SegmentBase struct {
-	Initialization Initialization `xml:"Initialization"`
+	IndexRange             string         `xml:"indexRange,attr"`
+	Timescale              string         `xml:"timescale,attr"`
+	PresentationTimeOffset string         `xml:"presentationTimeOffset,attr"`
+	Initialization         Initialization `xml:"Initialization"`
 }
 
 type SegmentList struct {
-	Duration       string         `xml:"duration,attr"`
-	Timescale      string         `xml:"timescale,attr"`
-	Initialization Initialization `xml:"Initialization"`
-	SegmentURLs    []SegmentURL   `xml:"SegmentURL"`
+	Duration               string         `xml:"duration,attr"`
+	Timescale              string         `xml:"timescale,attr"`
+	PresentationTimeOffset string         `xml:"presentationTimeOffset,attr"`
+	Initialization         Initialization `xml:"Initialization"`
+	SegmentURLs            []SegmentURL   `xml:"SegmentURL"`
 }
 
 type SegmentTemplate struct {
@@ -125,6 +174,11 @@ type AudioChannelConfiguration struct {
 
 type ContentProtection struct {
 	SchemeIdUri string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+	DefaultKID  string `xml:"default_KID,attr"` // cenc:default_KID
+	PSSH        string `xml:"pssh"`             // cenc:pssh
+	PRO         string `xml:"pro"`              // mspr:pro
+	Laurl       string `xml:"Laurl"`            // dashif:Laurl 或 clearkey:Laurl
 }
 
 // NewDASHParser 创建DASH解析器
@@ -135,6 +189,11 @@ func NewDASHParser(mpdURL string) *DASHParser {
 	}
 }
 
+// SetHeaders 设置请求头，用于获取sidx索引等附加数据
+func (p *DASHParser) SetHeaders(headers map[string]string) {
+	p.headers = headers
+}
+
 // Parse 解析DASH流
 func (p *DASHParser) Parse(mpdContent string) ([]*entity.StreamSpec, error) {
 	p.mpdContent = mpdContent
@@ -147,6 +206,9 @@ func (p *DASHParser) Parse(mpdContent string) ([]*entity.StreamSpec, error) {
 
 	util.Logger.Debug(fmt.Sprintf("解析MPD: type=%s, periods=%d", mpd.Type, len(mpd.Periods)))
 
+	// 解析远程Period和AdaptationSet
+	mpd.Periods = p.resolvePeriodXlinks(mpd.Periods, p.mpdURL, 0)
+
 	var streams []*entity.StreamSpec
 	isLive := mpd.Type == "dynamic"
 
@@ -161,13 +223,67 @@ func (p *DASHParser) Parse(mpdContent string) ([]*entity.StreamSpec, error) {
 	}
 
 	// 解析所有Period
-	for _, period := range mpd.Periods {
+	var periodInfos []dashPeriodInfo
+	var periodStart float64
+	for i, period := range mpd.Periods {
+		// 多Period时需要用ID区分来源
+		if period.ID == "" && len(mpd.Periods) > 1 {
+			period.ID = strconv.Itoa(i)
+		}
+		if period.Start != "" {
+			if d, err := p.parseISO8601Duration(period.Start); err == nil {
+				periodStart = d.Seconds()
+			}
+		}
 		periodStreams, err := p.parsePeriod(period, mpd, isLive)
 		if err != nil {
 			util.Logger.Warn(fmt.Sprintf("解析Period失败: %v", err))
 			continue
 		}
 		streams = append(streams, periodStreams...)
+
+		// 分片时间解析时相对于Period起点，这里换算到演示时间轴
+		for _, stream := range periodStreams {
+			for _, part := range stream.Playlist.MediaParts {
+				part.PeriodStart = periodStart
+				for _, segment := range part.MediaSegments {
+					if segment.StartTime != nil {
+						*segment.StartTime += periodStart
+					}
+				}
+			}
+		}
+
+		// Period级别的事件附加到该Period的所有流
+		if events := p.parseEventStreams(period, periodStart); len(events) > 0 {
+			for _, stream := range periodStreams {
+				stream.Events = append(stream.Events, events...)
+			}
+		}
+
+		info := dashPeriodInfo{ID: period.ID, Host: urlHost(p.extendBaseURL(period, p.baseURL))}
+		if period.Duration != "" {
+			if d, err := p.parseISO8601Duration(period.Duration); err == nil {
+				info.Duration = d.Seconds()
+			}
+		}
+		periodInfos = append(periodInfos, info)
+
+		// 未声明时长时按其中最长的流推算下一个Period的起始时间
+		periodDuration := info.Duration
+		if periodDuration == 0 {
+			for _, stream := range periodStreams {
+				if d := stream.Playlist.GetTotalDuration(); d > periodDuration {
+					periodDuration = d
+				}
+			}
+		}
+		periodStart += periodDuration
+	}
+
+	// 点播时合并多Period中的相同流
+	if !isLive {
+		streams = p.mergePeriods(streams, periodInfos)
 	}
 
 	// 设置默认轨道关联
@@ -242,27 +358,35 @@ func (p *DASHParser) parseRepresentation(repr Representation, adaptationSet Adap
 	}
 
 	// 设置媒体类型
-	if mimeType == "" {
+	// contentType只有主类型（如image），此时优先使用完整的mimeType
+	if !strings.Contains(mimeType, "/") && repr.MimeType != "" {
 		mimeType = repr.MimeType
 	}
-	if mimeType == "" {
+	if !strings.Contains(mimeType, "/") && adaptationSet.MimeType != "" {
 		mimeType = adaptationSet.MimeType
 	}
 
 	if mimeType != "" {
-		parts := strings.Split(mimeType, "/")
-		if len(parts) >= 2 {
-			mediaType := entity.MediaTypeUnknown
-			switch parts[0] {
-			case "text":
-				mediaType = entity.MediaTypeSubtitles
-			case "audio":
-				mediaType = entity.MediaTypeAudio
-			case "video":
-				mediaType = entity.MediaTypeVideo
-			}
+		parts := strings.SplitN(mimeType, "/", 2)
+		mediaType := entity.MediaTypeUnknown
+		switch parts[0] {
+		case "text":
+			mediaType = entity.MediaTypeSubtitles
+		case "audio":
+			mediaType = entity.MediaTypeAudio
+		case "video":
+			mediaType = entity.MediaTypeVideo
+		case "image":
+			mediaType = entity.MediaTypeImages
+		}
+		if len(parts) == 2 {
 			stream.MediaType = &mediaType
 			stream.Extension = parts[1]
+			if mediaType == entity.MediaTypeImages && parts[1] == "jpeg" {
+				stream.Extension = "jpg"
+			}
+		} else if mediaType != entity.MediaTypeUnknown {
+			stream.MediaType = &mediaType
 		}
 	}
 
@@ -319,6 +443,16 @@ func (p *DASHParser) parseRepresentation(repr Representation, adaptationSet Adap
 		}
 	}
 
+	// 处理Accessibility、Label和EssentialProperty/SupplementalProperty
+	p.parseDescriptors(stream, repr, adaptationSet)
+
+	// 分片内携带emsg事件的scheme
+	for _, inband := range append(append([]Descriptor{}, adaptationSet.InbandEventStreams...), repr.InbandEventStreams...) {
+		if inband.SchemeIdUri != "" {
+			stream.InbandEventSchemes = append(stream.InbandEventSchemes, inband.SchemeIdUri)
+		}
+	}
+
 	// 优化字幕场景识别 - 关键TTML检测逻辑
 	if stream.Codecs == "stpp" || stream.Codecs == "wvtt" {
 		mediaType := entity.MediaTypeSubtitles
@@ -365,13 +499,19 @@ func (p *DASHParser) parseRepresentation(repr Representation, adaptationSet Adap
 	}
 
 	// 处理加密
-	if p.hasContentProtection(repr.ContentProtection) || p.hasContentProtection(adaptationSet.ContentProtection) {
+	protections := append(append([]ContentProtection{}, adaptationSet.ContentProtection...), repr.ContentProtection...)
+	if p.hasContentProtection(protections) {
+		stream.DefaultKID, stream.DRMInfos = p.parseContentProtections(protections, reprBaseURL)
+		method := p.parseProtectionScheme(protections)
 		if stream.Playlist.MediaInit != nil {
-			stream.Playlist.MediaInit.EncryptInfo.Method = entity.EncryptMethodCENC
+			stream.Playlist.MediaInit.EncryptInfo.Method = method
+			stream.Playlist.MediaInit.EncryptInfo.KID = stream.DefaultKID
 		}
 		for _, part := range stream.Playlist.MediaParts {
 			for _, seg := range part.MediaSegments {
-				seg.EncryptInfo.Method = entity.EncryptMethodCENC
+				seg.EncryptInfo.Method = method
+				seg.EncryptInfo.KID = stream.DefaultKID
+				seg.IsEncrypted = true
 			}
 		}
 	}
@@ -380,7 +520,7 @@ func (p *DASHParser) parseRepresentation(repr Representation, adaptationSet Adap
 	if stream.MediaType != nil && *stream.MediaType == entity.MediaTypeSubtitles && stream.Extension == "mp4" {
 		stream.Extension = "m4s"
 	}
-	if stream.MediaType != nil && *stream.MediaType != entity.MediaTypeSubtitles && (stream.Extension == "" || len(stream.Playlist.MediaParts[0].MediaSegments) > 1) {
+	if stream.MediaType != nil && *stream.MediaType != entity.MediaTypeSubtitles && *stream.MediaType != entity.MediaTypeImages && (stream.Extension == "" || len(stream.Playlist.MediaParts[0].MediaSegments) > 1) {
 		stream.Extension = "m4s"
 	}
 
@@ -390,8 +530,12 @@ func (p *DASHParser) parseRepresentation(repr Representation, adaptationSet Adap
 // parseSegments 解析分片信息
 func (p *DASHParser) parseSegments(stream *entity.StreamSpec, repr Representation, adaptationSet AdaptationSet, period Period, mpd MPD, baseURL string, isLive bool) error {
 	// 1. 处理SegmentBase
-	if repr.SegmentBase.Initialization.SourceURL != "" {
-		return p.parseSegmentBase(stream, repr.SegmentBase, baseURL, period, mpd)
+	segmentBase := repr.SegmentBase
+	if segmentBase.IndexRange == "" && segmentBase.Initialization.SourceURL == "" && segmentBase.Initialization.Range == "" {
+		segmentBase = adaptationSet.SegmentBase
+	}
+	if segmentBase.IndexRange != "" || segmentBase.Initialization.SourceURL != "" || segmentBase.Initialization.Range != "" {
+		return p.parseSegmentBase(stream, segmentBase, baseURL, period, mpd)
 	}
 
 	// 2. 处理SegmentList
@@ -425,6 +569,7 @@ func (p *DASHParser) parseSegments(stream *entity.StreamSpec, repr Representatio
 		segment.Index = 0
 		segment.URL = baseURL
 		segment.Duration = duration
+		segment.StartTime = new(float64)
 		stream.Playlist.MediaParts[0].MediaSegments = append(stream.Playlist.MediaParts[0].MediaSegments, segment)
 	}
 
@@ -432,29 +577,14 @@ func (p *DASHParser) parseSegments(stream *entity.StreamSpec, repr Representatio
 }
 
 // parseSegmentBase 解析SegmentBase
+// 有indexRange时读取sidx索引，按子分片拆分为多个带字节范围的分片，否则整个文件作为单个分片
 func (p *DASHParser) parseSegmentBase(stream *entity.StreamSpec, segmentBase SegmentBase, baseURL string, period Period, mpd MPD) error {
 	init := segmentBase.Initialization
-	if init.SourceURL == "" {
-		// 没有init URL，直接使用baseURL
-		duration := 0.0
-		if period.Duration != "" {
-			if d, err := p.parseISO8601Duration(period.Duration); err == nil {
-				duration = d.Seconds()
-			}
-		} else if mpd.MediaPresentationDuration != "" {
-			if d, err := p.parseISO8601Duration(mpd.MediaPresentationDuration); err == nil {
-				duration = d.Seconds()
-			}
+	if init.SourceURL != "" || init.Range != "" {
+		initURL := baseURL
+		if init.SourceURL != "" {
+			initURL = p.combineURL(baseURL, init.SourceURL)
 		}
-
-		segment := entity.NewMediaSegment()
-		segment.Index = 0
-		segment.URL = baseURL
-		segment.Duration = duration
-		stream.Playlist.MediaParts[0].MediaSegments = append(stream.Playlist.MediaParts[0].MediaSegments, segment)
-	} else {
-		// 有init URL
-		initURL := p.combineURL(baseURL, init.SourceURL)
 		stream.Playlist.MediaInit = entity.NewMediaSegment()
 		stream.Playlist.MediaInit.Index = -1
 		stream.Playlist.MediaInit.URL = initURL
@@ -466,9 +596,104 @@ func (p *DASHParser) parseSegmentBase(stream *entity.StreamSpec, segmentBase Seg
 		}
 	}
 
+	if segmentBase.IndexRange != "" {
+		segments, err := p.parseSidxSegments(baseURL, segmentBase.IndexRange, segmentBase.Timescale, segmentBase.PresentationTimeOffset)
+		if err == nil {
+			// 未声明Initialization时，索引之前的部分即为init
+			if stream.Playlist.MediaInit == nil {
+				if indexStart, _ := p.parseRange(segmentBase.IndexRange); indexStart > 0 {
+					var initStart int64
+					stream.Playlist.MediaInit = entity.NewMediaSegment()
+					stream.Playlist.MediaInit.Index = -1
+					stream.Playlist.MediaInit.URL = baseURL
+					stream.Playlist.MediaInit.StartRange = &initStart
+					stream.Playlist.MediaInit.ExpectLength = &indexStart
+				}
+			}
+
+			var totalBytes int64
+			for _, segment := range segments {
+				totalBytes += *segment.ExpectLength
+			}
+			stream.Playlist.MediaParts[0].MediaSegments = append(stream.Playlist.MediaParts[0].MediaSegments, segments...)
+			stream.Playlist.MediaParts[0].PresentationTimeOffset = p.presentationTimeOffset(segmentBase.Timescale, segmentBase.PresentationTimeOffset)
+			stream.Playlist.TotalBytes = totalBytes
+			util.Logger.Debug("通过sidx拆分得到 %d 个分片: %s", len(segments), baseURL)
+			return nil
+		}
+		util.Logger.Warn("解析sidx索引失败，将整个文件作为单个分片: %s", err.Error())
+	}
+
+	// 整个文件作为单个分片，init位于同一文件内时无需单独下载
+	if init.SourceURL == "" {
+		stream.Playlist.MediaInit = nil
+	}
+
+	duration := 0.0
+	if period.Duration != "" {
+		if d, err := p.parseISO8601Duration(period.Duration); err == nil {
+			duration = d.Seconds()
+		}
+	} else if mpd.MediaPresentationDuration != "" {
+		if d, err := p.parseISO8601Duration(mpd.MediaPresentationDuration); err == nil {
+			duration = d.Seconds()
+		}
+	}
+
+	segment := entity.NewMediaSegment()
+	segment.Index = 0
+	segment.URL = baseURL
+	segment.Duration = duration
+	segment.StartTime = new(float64)
+	stream.Playlist.MediaParts[0].MediaSegments = append(stream.Playlist.MediaParts[0].MediaSegments, segment)
+
 	return nil
 }
 
+// parseSidxSegments 获取indexRange对应的sidx索引，并生成每个子分片的字节范围、时长和起始时间
+func (p *DASHParser) parseSidxSegments(url, indexRange, timescale, presentationTimeOffset string) ([]*entity.MediaSegment, error) {
+	indexStart, indexLength := p.parseRange(indexRange)
+	if indexLength <= 0 {
+		return nil, fmt.Errorf("无效的indexRange: %s", indexRange)
+	}
+
+	data, err := util.GetBytesRange(url, p.headers, indexStart, &indexLength)
+	if err != nil {
+		return nil, fmt.Errorf("获取sidx索引失败: %w", err)
+	}
+
+	sidx, err := util.ParseSidx(data, indexStart)
+	if err != nil {
+		return nil, err
+	}
+	if len(sidx.References) == 0 {
+		return nil, fmt.Errorf("sidx索引中没有子分片")
+	}
+
+	pto := p.presentationTimeOffset(timescale, presentationTimeOffset)
+	currentTime := sidx.EarliestPresentationTime
+	segments := make([]*entity.MediaSegment, 0, len(sidx.References))
+	for i, ref := range sidx.References {
+		if ref.IsSidx {
+			return nil, fmt.Errorf("暂不支持多级sidx索引")
+		}
+		startRange := ref.Offset
+		expectLength := ref.Size
+
+		segment := entity.NewMediaSegment()
+		segment.Index = int64(i)
+		segment.URL = url
+		segment.Duration = float64(ref.Duration) / float64(sidx.Timescale)
+		segment.StartTime = floatPtr(float64(currentTime)/float64(sidx.Timescale) - pto)
+		segment.StartRange = &startRange
+		segment.ExpectLength = &expectLength
+		segments = append(segments, segment)
+		currentTime += ref.Duration
+	}
+
+	return segments, nil
+}
+
 // parseSegmentList 解析SegmentList
 func (p *DASHParser) parseSegmentList(stream *entity.StreamSpec, segmentList SegmentList, baseURL string) error {
 	// 处理init
@@ -501,12 +726,16 @@ func (p *DASHParser) parseSegmentList(stream *entity.StreamSpec, segmentList Seg
 		}
 	}
 
+	stream.Playlist.MediaParts[0].PresentationTimeOffset = p.presentationTimeOffset(segmentList.Timescale, segmentList.PresentationTimeOffset)
 	for i, segURL := range segmentList.SegmentURLs {
 		mediaURL := p.combineURL(baseURL, segURL.Media)
 		segment := entity.NewMediaSegment()
 		segment.Index = int64(i)
 		segment.URL = mediaURL
 		segment.Duration = float64(duration) / float64(timescale)
+		if duration > 0 {
+			segment.StartTime = floatPtr(float64(i) * segment.Duration)
+		}
 
 		if segURL.MediaRange != "" {
 			start, expectLength := p.parseRange(segURL.MediaRange)
@@ -566,9 +795,12 @@ func (p *DASHParser) parseSegmentTemplateMedia(stream *entity.StreamSpec, templa
 		}
 	}
 
+	pto := p.presentationTimeOffset(template.Timescale, template.PresentationTimeOffset)
+	stream.Playlist.MediaParts[0].PresentationTimeOffset = pto
+
 	// 有SegmentTimeline的情况
 	if len(template.SegmentTimeline.S) > 0 {
-		return p.parseSegmentTimeline(stream, template, vars, baseURL, timescale, startNumber)
+		return p.parseSegmentTimeline(stream, template, vars, baseURL, timescale, startNumber, pto)
 	}
 
 	// 没有SegmentTimeline，需要计算
@@ -600,6 +832,9 @@ func (p *DASHParser) parseSegmentTemplateMedia(stream *entity.StreamSpec, templa
 		totalNumber = int64(math.Ceil(totalDuration * float64(timescale) / float64(duration)))
 	}
 
+	// 直播时起始序号会前移，分片时间仍以声明的startNumber为起点
+	firstNumber := startNumber
+
 	// 直播情况下计算
 	if totalNumber == 0 && isLive {
 		if mpd.AvailabilityStartTime != "" && mpd.TimeShiftBufferDepth != "" {
@@ -630,6 +865,7 @@ func (p *DASHParser) parseSegmentTemplateMedia(stream *entity.StreamSpec, templa
 		segment := entity.NewMediaSegment()
 		segment.URL = mediaURL
 		segment.Duration = float64(duration) / float64(timescale)
+		segment.StartTime = floatPtr(float64(index-firstNumber) * segment.Duration)
 		segment.NameFromVar = strconv.FormatInt(index, 10)
 
 		if isLive {
@@ -645,7 +881,8 @@ func (p *DASHParser) parseSegmentTemplateMedia(stream *entity.StreamSpec, templa
 }
 
 // parseSegmentTimeline 解析SegmentTimeline
-func (p *DASHParser) parseSegmentTimeline(stream *entity.StreamSpec, template SegmentTemplate, vars map[string]string, baseURL string, timescale int, startNumber int64) error {
+// pto为presentationTimeOffset换算后的秒数，分片起始时间需扣除
+func (p *DASHParser) parseSegmentTimeline(stream *entity.StreamSpec, template SegmentTemplate, vars map[string]string, baseURL string, timescale int, startNumber int64, pto float64) error {
 	currentTime := int64(0)
 	segIndex := int64(0)
 	segNumber := startNumber
@@ -688,6 +925,7 @@ func (p *DASHParser) parseSegmentTimeline(stream *entity.StreamSpec, template Se
 		segment.Index = segIndex
 		segment.URL = mediaURL
 		segment.Duration = float64(duration) / float64(timescale)
+		segment.StartTime = floatPtr(float64(currentTime)/float64(timescale) - pto)
 
 		if hasTime {
 			segment.NameFromVar = strconv.FormatInt(currentTime, 10)
@@ -710,6 +948,7 @@ func (p *DASHParser) parseSegmentTimeline(stream *entity.StreamSpec, template Se
 			segment.Index = segIndex
 			segment.URL = mediaURL
 			segment.Duration = float64(duration) / float64(timescale)
+			segment.StartTime = floatPtr(float64(currentTime)/float64(timescale) - pto)
 
 			if hasTime {
 				segment.NameFromVar = strconv.FormatInt(currentTime, 10)
@@ -893,6 +1132,16 @@ func (p *DASHParser) parseRole(role string) entity.RoleType {
 		return entity.RoleTypeCommentary
 	case "dub":
 		return entity.RoleTypeDub
+	case "caption":
+		return entity.RoleTypeCaption
+	case "description":
+		return entity.RoleTypeDescription
+	case "sign":
+		return entity.RoleTypeSign
+	case "emergency":
+		return entity.RoleTypeEmergency
+	case "metadata":
+		return entity.RoleTypeMetadata
 	default:
 		return entity.RoleTypeMain
 	}
@@ -913,6 +1162,28 @@ func (p *DASHParser) parseRange(rangeStr string) (int64, int64) {
 	return start, end - start + 1
 }
 
+// presentationTimeOffset 将presentationTimeOffset按timescale换算为秒
+func (p *DASHParser) presentationTimeOffset(timescale, offset string) float64 {
+	if offset == "" {
+		return 0
+	}
+	pto, err := strconv.ParseUint(offset, 10, 64)
+	if err != nil {
+		return 0
+	}
+	ts := uint64(1)
+	if timescale != "" {
+		if v, err := strconv.ParseUint(timescale, 10, 64); err == nil && v > 0 {
+			ts = v
+		}
+	}
+	return float64(pto) / float64(ts)
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
 func (p *DASHParser) parseISO8601Duration(duration string) (time.Duration, error) {
 	// 简单的ISO8601 duration解析
 	// 支持格式如: PT1M30S, PT30S, PT1H等
@@ -1013,6 +1284,84 @@ func (p *DASHParser) hasContentProtection(protections []ContentProtection) bool
 	return len(protections) > 0
 }
 
+// parseProtectionScheme 根据mp4protection的value判断加密方案，cbcs/cbc1对应CBCS，其余按CENC处理
+func (p *DASHParser) parseProtectionScheme(protections []ContentProtection) entity.EncryptMethod {
+	for _, cp := range protections {
+		if !strings.EqualFold(strings.TrimSpace(cp.SchemeIdUri), "urn:mpeg:dash:mp4protection:2011") {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(cp.Value)) {
+		case "cbcs", "cbc1":
+			return entity.EncryptMethodCBCS
+		}
+	}
+	return entity.EncryptMethodCENC
+}
+
+// parseContentProtections 解析ContentProtection中的default_KID、pssh、PlayReady Object和许可证地址
+func (p *DASHParser) parseContentProtections(protections []ContentProtection, baseURL string) (string, []*entity.DRMInfo) {
+	var defaultKID string
+	var drmInfos []*entity.DRMInfo
+	drmBySystem := make(map[string]*entity.DRMInfo)
+
+	for _, cp := range protections {
+		if kid := util.NormalizeKID(cp.DefaultKID); kid != "" && defaultKID == "" {
+			defaultKID = kid
+		}
+
+		schemeIdUri := strings.ToLower(strings.TrimSpace(cp.SchemeIdUri))
+		if !strings.HasPrefix(schemeIdUri, "urn:uuid:") {
+			continue
+		}
+
+		systemID := util.NormalizeSystemID(schemeIdUri)
+		info, ok := drmBySystem[systemID]
+		if !ok {
+			info = &entity.DRMInfo{
+				SystemID: systemID,
+				Name:     util.GetDRMSystemName(systemID),
+			}
+			drmBySystem[systemID] = info
+			drmInfos = append(drmInfos, info)
+		}
+		// Representation级别的信息覆盖AdaptationSet级别
+		if pssh := strings.TrimSpace(cp.PSSH); pssh != "" {
+			info.PSSH = pssh
+		}
+		if pro := strings.TrimSpace(cp.PRO); pro != "" {
+			info.PRO = pro
+		}
+		if laurl := strings.TrimSpace(cp.Laurl); laurl != "" {
+			info.LicenseURL = p.combineURL(baseURL, laurl)
+		}
+	}
+
+	// 从pssh和PlayReady Object中提取各系统声明的KID
+	for _, info := range drmInfos {
+		if info.PSSH != "" {
+			if pssh, err := util.ParsePSSHBase64(info.PSSH); err == nil {
+				info.KIDs = pssh.KIDs
+			} else {
+				util.Logger.Debug("解析%s pssh失败: %v", info.Name, err)
+			}
+		}
+		if len(info.KIDs) == 0 && info.PRO != "" {
+			if header, err := util.ParsePlayReadyHeaderBase64(info.PRO); err == nil {
+				info.KIDs = header.KIDs
+			}
+		}
+	}
+
+	if defaultKID != "" {
+		util.Logger.Debug("解析到default_KID: %s", defaultKID)
+	}
+	for _, info := range drmInfos {
+		util.Logger.Debug("解析到DRM系统: %s (%s), KID: %s", info.Name, info.SystemID, strings.Join(info.KIDs, ","))
+	}
+
+	return defaultKID, drmInfos
+}
+
 func (p *DASHParser) setDefaultTrackAssociations(streams []*entity.StreamSpec) {
 	var audioStreams []*entity.StreamSpec
 	var subtitleStreams []*entity.StreamSpec
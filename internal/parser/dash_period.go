@@ -0,0 +1,195 @@
+package parser
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"N_m3u8DL-RE-GO/internal/entity"
+	"N_m3u8DL-RE-GO/internal/util"
+)
+
+// 短于该时长（秒）且明显短于正片的Period视为疑似广告
+const adPeriodMaxDuration = 60.0
+
+// dashPeriodInfo Period概要信息，用于合并和广告识别
+type dashPeriodInfo struct {
+	ID       string
+	Host     string
+	Duration float64
+}
+
+// mergePeriods 合并多个Period中的相同流
+// 优先按Representation ID匹配，其次按媒体类型+编码+分辨率+语言匹配
+// 合并后的流每个Period对应一个MediaPart，并通过MediaPart.PeriodID保留来源
+func (p *DASHParser) mergePeriods(streams []*entity.StreamSpec, periods []dashPeriodInfo) []*entity.StreamSpec {
+	if len(periods) <= 1 {
+		return streams
+	}
+
+	adPeriods := p.detectAdPeriods(periods, streams)
+
+	// 为每个流的分片部分标记Period
+	for _, stream := range streams {
+		for _, part := range stream.Playlist.MediaParts {
+			part.PeriodID = stream.PeriodID
+			part.IsAd = adPeriods[stream.PeriodID]
+		}
+	}
+
+	var merged []*entity.StreamSpec
+	byID := make(map[string]*entity.StreamSpec)
+	bySignature := make(map[string]*entity.StreamSpec)
+	signatureCount := make(map[string]int)
+	lastPeriod := ""
+
+	for _, stream := range streams {
+		if stream.PeriodID != lastPeriod {
+			// 新Period开始，重置同签名计数
+			signatureCount = make(map[string]int)
+			lastPeriod = stream.PeriodID
+		}
+
+		mediaType := entity.MediaTypeUnknown
+		if stream.MediaType != nil {
+			mediaType = *stream.MediaType
+		}
+		idKey := fmt.Sprintf("%d|%s", mediaType, stream.GroupID)
+		signature := fmt.Sprintf("%d|%s|%s|%s", mediaType, stream.Codecs, stream.Resolution, stream.Language)
+		signatureKey := fmt.Sprintf("%s#%d", signature, signatureCount[signature])
+		signatureCount[signature]++
+
+		target := byID[idKey]
+		if target != nil && p.hasPeriod(target, stream.PeriodID) {
+			target = nil
+		}
+		if target == nil {
+			target = bySignature[signatureKey]
+			if target != nil && p.hasPeriod(target, stream.PeriodID) {
+				target = nil
+			}
+		}
+
+		if target == nil {
+			merged = append(merged, stream)
+			byID[idKey] = stream
+			bySignature[signatureKey] = stream
+			continue
+		}
+
+		p.appendPeriod(target, stream)
+		byID[idKey] = target
+		bySignature[signatureKey] = target
+	}
+
+	// 重新编号分片，保证合并后的序号唯一且连续
+	for _, stream := range merged {
+		if len(stream.Playlist.MediaParts) <= 1 {
+			continue
+		}
+		var index int64
+		for _, part := range stream.Playlist.MediaParts {
+			for _, segment := range part.MediaSegments {
+				segment.Index = index
+				index++
+			}
+		}
+		util.Logger.Debug("合并多Period流: %s, Period数=%d", stream.ToShortString(), len(stream.Playlist.MediaParts))
+	}
+
+	if len(merged) < len(streams) {
+		util.Logger.Info("已合并多Period中的相同流: %d -> %d", len(streams), len(merged))
+	}
+
+	return merged
+}
+
+// hasPeriod 判断流是否已经包含某个Period的分片
+func (p *DASHParser) hasPeriod(stream *entity.StreamSpec, periodID string) bool {
+	for _, part := range stream.Playlist.MediaParts {
+		if part.PeriodID == periodID {
+			return true
+		}
+	}
+	return false
+}
+
+// appendPeriod 将另一个Period中的流追加到目标流
+// init不同时，将新的init作为该部分的第一个分片插入，保证二进制合并后解码器能正确切换
+func (p *DASHParser) appendPeriod(target, stream *entity.StreamSpec) {
+	targetInit := target.Playlist.MediaInit
+	streamInit := stream.Playlist.MediaInit
+
+	for i, part := range stream.Playlist.MediaParts {
+		if i == 0 && streamInit != nil && (targetInit == nil || targetInit.URL != streamInit.URL ||
+			!equalRange(targetInit.StartRange, streamInit.StartRange)) {
+			initSegment := *streamInit
+			initSegment.Duration = 0
+			initSegment.IsEncrypted = streamInit.EncryptInfo != nil && streamInit.EncryptInfo.IsEncrypted()
+			part.MediaSegments = append([]*entity.MediaSegment{&initSegment}, part.MediaSegments...)
+			util.Logger.Debug("Period %s 的init与前一Period不同，插入init分片", stream.PeriodID)
+		}
+		target.Playlist.MediaParts = append(target.Playlist.MediaParts, part)
+	}
+
+	target.Playlist.TotalBytes += stream.Playlist.TotalBytes
+	target.Events = append(target.Events, stream.Events...)
+}
+
+// equalRange 比较两个可选的字节范围起点
+func equalRange(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// detectAdPeriods 识别疑似广告的Period
+// 时长很短（且远短于最长Period），或BaseURL主机与正片不同的Period被视为广告
+func (p *DASHParser) detectAdPeriods(periods []dashPeriodInfo, streams []*entity.StreamSpec) map[string]bool {
+	// 未声明时长的Period按其中最长的流计算
+	for i := range periods {
+		if periods[i].Duration > 0 {
+			continue
+		}
+		for _, stream := range streams {
+			if stream.PeriodID == periods[i].ID {
+				if d := stream.Playlist.GetTotalDuration(); d > periods[i].Duration {
+					periods[i].Duration = d
+				}
+			}
+		}
+	}
+
+	// 以最长的Period作为正片参考
+	main := periods[0]
+	for _, period := range periods[1:] {
+		if period.Duration > main.Duration {
+			main = period
+		}
+	}
+
+	adPeriods := make(map[string]bool)
+	for _, period := range periods {
+		if period.ID == main.ID {
+			continue
+		}
+		isShort := period.Duration > 0 && period.Duration <= adPeriodMaxDuration && period.Duration*5 < main.Duration
+		isOtherHost := period.Host != "" && main.Host != "" && !strings.EqualFold(period.Host, main.Host)
+		if isShort || isOtherHost {
+			adPeriods[period.ID] = true
+			util.Logger.Warn("Period %s 疑似广告 (时长: %.2fs, 主机: %s)", period.ID, period.Duration, period.Host)
+		}
+	}
+
+	return adPeriods
+}
+
+// urlHost 获取URL的主机名
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"N_m3u8DL-RE-GO/internal/util"
+)
+
+// xlink最大递归深度，防止远程文档互相引用导致死循环
+const xlinkMaxDepth = 5
+
+// 指向该URN的xlink表示元素应被移除
+const xlinkResolveToZero = "urn:mpeg:dash:resolve-to-zero:2013"
+
+// 只有xlink:actuate为onLoad的元素在解析时获取，缺省值onRequest表示由播放器按需获取
+const xlinkActuateOnLoad = "onLoad"
+
+// xlinkPeriods 远程文档中的Period列表
+type xlinkPeriods struct {
+	Periods []Period `xml:"Period"`
+}
+
+// xlinkAdaptationSets 远程文档中的AdaptationSet列表
+type xlinkAdaptationSets struct {
+	AdaptationSets []AdaptationSet `xml:"AdaptationSet"`
+}
+
+// resolvePeriodXlinks 解析Period的xlink:href，用远程文档中的Period替换原元素
+// docURL为当前元素所在文档的URL，用于解析相对地址
+func (p *DASHParser) resolvePeriodXlinks(periods []Period, docURL string, depth int) []Period {
+	var result []Period
+	for _, period := range periods {
+		if period.Href == "" || period.Actuate != xlinkActuateOnLoad {
+			period.AdaptationSets = p.resolveAdaptationSetXlinks(period.AdaptationSets, docURL, depth)
+			result = append(result, period)
+			continue
+		}
+
+		if period.Href == xlinkResolveToZero {
+			util.Logger.Debug("移除xlink指向resolve-to-zero的Period: %s", period.ID)
+			continue
+		}
+
+		if depth >= xlinkMaxDepth {
+			util.Logger.Warn("xlink嵌套超过 %d 层，忽略: %s", xlinkMaxDepth, period.Href)
+			period.Href = ""
+			result = append(result, period)
+			continue
+		}
+
+		remoteURL := p.combineURL(docURL, period.Href)
+		var remote xlinkPeriods
+		if err := p.fetchXlink(remoteURL, &remote); err != nil {
+			util.Logger.Warn("解析Period xlink失败，使用本地内容: %s", err.Error())
+			period.Href = ""
+			period.AdaptationSets = p.resolveAdaptationSetXlinks(period.AdaptationSets, docURL, depth)
+			result = append(result, period)
+			continue
+		}
+
+		util.Logger.Debug("xlink %s 解析得到 %d 个Period", remoteURL, len(remote.Periods))
+		result = append(result, p.resolvePeriodXlinks(remote.Periods, remoteURL, depth+1)...)
+	}
+	return result
+}
+
+// resolveAdaptationSetXlinks 解析AdaptationSet的xlink:href
+func (p *DASHParser) resolveAdaptationSetXlinks(adaptationSets []AdaptationSet, docURL string, depth int) []AdaptationSet {
+	var result []AdaptationSet
+	for _, adaptationSet := range adaptationSets {
+		if adaptationSet.Href == "" || adaptationSet.Actuate != xlinkActuateOnLoad {
+			result = append(result, adaptationSet)
+			continue
+		}
+
+		if adaptationSet.Href == xlinkResolveToZero {
+			continue
+		}
+
+		if depth >= xlinkMaxDepth {
+			util.Logger.Warn("xlink嵌套超过 %d 层，忽略: %s", xlinkMaxDepth, adaptationSet.Href)
+			adaptationSet.Href = ""
+			result = append(result, adaptationSet)
+			continue
+		}
+
+		remoteURL := p.combineURL(docURL, adaptationSet.Href)
+		var remote xlinkAdaptationSets
+		if err := p.fetchXlink(remoteURL, &remote); err != nil {
+			util.Logger.Warn("解析AdaptationSet xlink失败，使用本地内容: %s", err.Error())
+			adaptationSet.Href = ""
+			result = append(result, adaptationSet)
+			continue
+		}
+
+		result = append(result, p.resolveAdaptationSetXlinks(remote.AdaptationSets, remoteURL, depth+1)...)
+	}
+	return result
+}
+
+// fetchXlink 获取远程文档并解析
+// 远程文档可能包含多个同级元素而没有根元素，因此统一包裹一层后再解析
+func (p *DASHParser) fetchXlink(remoteURL string, v interface{}) error {
+	content, err := util.GetString(remoteURL, p.headers)
+	if err != nil {
+		return fmt.Errorf("获取xlink文档失败: %w", err)
+	}
+
+	content = strings.TrimSpace(strings.TrimPrefix(content, "\ufeff"))
+	if strings.HasPrefix(content, "<?xml") {
+		if end := strings.Index(content, "?>"); end >= 0 {
+			content = content[end+2:]
+		}
+	}
+
+	wrapped := `<XLinkRoot xmlns:xlink="http://www.w3.org/1999/xlink">` + content + `</XLinkRoot>`
+	if err := xml.Unmarshal([]byte(wrapped), v); err != nil {
+		return fmt.Errorf("解析xlink文档失败: %w", err)
+	}
+	return nil
+}
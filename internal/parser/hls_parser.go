@@ -31,21 +31,43 @@ const (
 	TagEXTXMEDIA           = "#EXT-X-MEDIA"
 	TagEXTXBYTERANGE       = "#EXT-X-BYTERANGE"
 	TagEXTXPROGRAMDATETIME = "#EXT-X-PROGRAM-DATE-TIME"
+	TagEXTXSESSIONKEY      = "#EXT-X-SESSION-KEY"
+	TagEXTXSESSIONDATA     = "#EXT-X-SESSION-DATA"
 )
 
 // HLSParser HLS解析器
 type HLSParser struct {
-	baseURL string
-	headers map[string]string
+	baseURL       string
+	headers       map[string]string
+	keyProcessors []KeyProcessor
+	// 密钥缓存，key为密钥URI，EXT-X-SESSION-KEY会提前写入
+	keyCache map[string][]byte
+	// 用户指定的加密方法、密钥和IV，覆盖清单中的EXT-X-KEY
+	customMethod *entity.EncryptMethod
+	customKey    []byte
+	customIV     []byte
 }
 
 // NewHLSParser 创建HLS解析器
 func NewHLSParser() *HLSParser {
 	return &HLSParser{
-		headers: make(map[string]string),
+		headers:  make(map[string]string),
+		keyCache: make(map[string][]byte),
 	}
 }
 
+// AddKeyProcessor 添加密钥处理器
+func (p *HLSParser) AddKeyProcessor(processor KeyProcessor) {
+	p.keyProcessors = append(p.keyProcessors, processor)
+}
+
+// SetCustomEncryption 设置自定义的加密方法、密钥和IV，为nil的项保留清单中的值
+func (p *HLSParser) SetCustomEncryption(method *entity.EncryptMethod, key, iv []byte) {
+	p.customMethod = method
+	p.customKey = key
+	p.customIV = iv
+}
+
 // ParseM3U8 解析M3U8内容
 func (p *HLSParser) ParseM3U8(content, baseURL string, headers map[string]string) ([]*entity.StreamSpec, error) {
 	p.baseURL = baseURL
@@ -107,6 +129,8 @@ func (p *HLSParser) isMasterPlaylist(lines []string) bool {
 func (p *HLSParser) parseMasterPlaylist(lines []string) ([]*entity.StreamSpec, error) {
 	var streams []*entity.StreamSpec
 	var currentStream *entity.StreamSpec
+	var sessionKeys []*entity.EncryptInfo
+	var sessionData []*entity.SessionData
 
 	for i, line := range lines {
 		line = strings.TrimSpace(line)
@@ -137,7 +161,30 @@ func (p *HLSParser) parseMasterPlaylist(lines []string) ([]*entity.StreamSpec, e
 				mediaStream.URL = p.resolveURL(mediaStream.URL)
 				streams = append(streams, mediaStream)
 			}
+		} else if strings.HasPrefix(line, TagEXTXSESSIONKEY) {
+			// 会话密钥，提前获取以预热密钥缓存
+			if keyInfo := p.parseSessionKey(line); keyInfo != nil {
+				sessionKeys = append(sessionKeys, keyInfo)
+			}
+		} else if strings.HasPrefix(line, TagEXTXSESSIONDATA) {
+			if data := p.parseSessionData(line); data != nil {
+				sessionData = append(sessionData, data)
+			}
+		}
+	}
+
+	if len(sessionKeys) > 0 {
+		var systems []string
+		for _, keyInfo := range sessionKeys {
+			systems = append(systems, fmt.Sprintf("%s(%s)", keyInfo.Method.String(), keyFormatSystemName(keyInfo.KeyFormat)))
 		}
+		util.Logger.Info("发现会话密钥: %s", strings.Join(systems, ", "))
+	}
+
+	// 会话级信息对所有流生效
+	for _, stream := range streams {
+		stream.SessionKeys = sessionKeys
+		stream.SessionData = sessionData
 	}
 
 	// 为主播放列表中的流设置扩展名
@@ -268,13 +315,7 @@ func (p *HLSParser) parseMediaPlaylist(lines []string) ([]*entity.StreamSpec, er
 				if currentEncryptInfo.IV != nil && len(currentEncryptInfo.IV) > 0 {
 					currentSegment.EncryptInfo.IV = currentEncryptInfo.IV
 				} else {
-					// 生成默认IV：按照C#版本的逻辑
-					// Convert.ToString(segIndex, 16).PadLeft(32, '0')
-					ivStr := fmt.Sprintf("%032x", currentSegment.Index)
-					if iv, err := hex.DecodeString(ivStr); err == nil {
-						currentSegment.EncryptInfo.IV = iv
-						util.Logger.Debug("为分段 %d 生成默认IV: %s", currentSegment.Index, ivStr)
-					}
+					currentSegment.EncryptInfo.IV = defaultSegmentIV(currentSegment.Index)
 				}
 
 				util.Logger.Debug("分段 %d 标记为加密: 方法=%s, 密钥长度=%d, IV长度=%d",
@@ -381,8 +422,11 @@ func (p *HLSParser) parseMediaPlaylist(lines []string) ([]*entity.StreamSpec, er
 		playlist.RefreshIntervalMs = (*playlist.TargetDuration) * 2 * 1000
 	}
 
+	p.applyCustomEncryption(playlist)
+
 	// 设置扩展名 - 按照C#版本逻辑 (lines 562-564)
 	if playlist.MediaInit != nil {
+		p.mapSampleEncryptionToCENC(playlist)
 		stream.Extension = "m4s"
 	} else {
 		stream.Extension = "ts"
@@ -401,6 +445,89 @@ func (p *HLSParser) parseMediaPlaylist(lines []string) ([]*entity.StreamSpec, er
 	return []*entity.StreamSpec{stream}, nil
 }
 
+// defaultSegmentIV 清单未提供IV时按分段序号生成默认IV
+// 按照C#版本的逻辑：Convert.ToString(segIndex, 16).PadLeft(32, '0')
+func defaultSegmentIV(index int64) []byte {
+	ivStr := fmt.Sprintf("%032x", index)
+	iv, _ := hex.DecodeString(ivStr)
+	util.Logger.Debug("为分段 %d 生成默认IV: %s", index, ivStr)
+	return iv
+}
+
+// applyCustomEncryption 用自定义的加密方法、密钥和IV覆盖所有分段的加密信息
+// 部分服务商会移除EXT-X-KEY并单独提供密钥，此时清单中未加密的分段同样标记为加密
+func (p *HLSParser) applyCustomEncryption(playlist *entity.Playlist) {
+	if p.customMethod == nil && p.customKey == nil && p.customIV == nil {
+		return
+	}
+
+	for _, seg := range playlist.GetAllSegments() {
+		if seg.EncryptInfo == nil {
+			seg.EncryptInfo = entity.NewEncryptInfo()
+		}
+		p.overrideEncryptInfo(seg.EncryptInfo, seg.Index)
+		seg.IsEncrypted = seg.EncryptInfo.IsEncrypted()
+	}
+
+	// 初始化段只有在清单中已加密时才整体解密，样本级加密只需同步加密方法
+	if init := playlist.MediaInit; init != nil {
+		if init.EncryptInfo == nil {
+			init.EncryptInfo = entity.NewEncryptInfo()
+		}
+		if init.EncryptInfo.IsEncrypted() {
+			p.overrideEncryptInfo(init.EncryptInfo, init.Index)
+			init.IsEncrypted = init.EncryptInfo.IsEncrypted()
+		} else if p.customMethod != nil && isSampleEncryption(*p.customMethod) {
+			init.EncryptInfo.Method = *p.customMethod
+		}
+	}
+}
+
+// overrideEncryptInfo 覆盖单个加密信息，只提供密钥时默认为AES-128
+func (p *HLSParser) overrideEncryptInfo(info *entity.EncryptInfo, index int64) {
+	if p.customMethod != nil {
+		info.Method = *p.customMethod
+	} else if info.Method == entity.EncryptMethodNone && p.customKey != nil {
+		info.Method = entity.EncryptMethodAES128
+	}
+	if p.customKey != nil {
+		info.Key = p.customKey
+	}
+	if p.customIV != nil {
+		info.IV = p.customIV
+	} else if len(info.IV) == 0 && info.IsEncrypted() {
+		info.IV = defaultSegmentIV(index)
+	}
+}
+
+// isSampleEncryption 是否为样本级加密，这类加密不会加密初始化段
+func isSampleEncryption(method entity.EncryptMethod) bool {
+	switch method {
+	case entity.EncryptMethodSampleAES, entity.EncryptMethodSampleAESCTR, entity.EncryptMethodCENC, entity.EncryptMethodCBCS:
+		return true
+	}
+	return false
+}
+
+// mapSampleEncryptionToCENC fMP4分段的SAMPLE-AES即cbcs、SAMPLE-AES-CTR即cenc，交由MP4解密引擎处理
+func (p *HLSParser) mapSampleEncryptionToCENC(playlist *entity.Playlist) {
+	infos := []*entity.EncryptInfo{playlist.MediaInit.EncryptInfo}
+	for _, seg := range playlist.GetAllSegments() {
+		infos = append(infos, seg.EncryptInfo)
+	}
+	for _, info := range infos {
+		if info == nil {
+			continue
+		}
+		switch info.Method {
+		case entity.EncryptMethodSampleAES:
+			info.Method = entity.EncryptMethodCBCS
+		case entity.EncryptMethodSampleAESCTR:
+			info.Method = entity.EncryptMethodCENC
+		}
+	}
+}
+
 // parseStreamAttributes 解析流属性
 func (p *HLSParser) parseStreamAttributes(line string, stream *entity.StreamSpec) {
 	// 提取属性部分
@@ -544,24 +671,127 @@ func (p *HLSParser) parseKeyInfo(line string) *entity.EncryptInfo {
 	encryptInfo := entity.NewEncryptInfo()
 	attrStr := line[len(TagEXTXKEY)+1:]
 	attrs := p.parseAttributes(attrStr)
+	p.parseKeyAttributes(attrs, encryptInfo)
+
+	if uri, ok := attrs["URI"]; ok {
+		encryptInfo.URI = p.resolveURL(strings.Trim(uri, `"`))
+		// 获取密钥
+		encryptInfo.Key = p.fetchKey(encryptInfo.URI, encryptInfo.KeyFormat)
+	}
+
+	return encryptInfo
+}
+
+// parseSessionKey 解析EXT-X-SESSION-KEY
+// 仅在KEYFORMAT为identity或有匹配的密钥处理器时才请求密钥，DRM系统的URI不是可直接获取的密钥
+func (p *HLSParser) parseSessionKey(line string) *entity.EncryptInfo {
+	if len(line) <= len(TagEXTXSESSIONKEY)+1 {
+		return nil
+	}
+	encryptInfo := entity.NewEncryptInfo()
+	attrs := p.parseAttributes(line[len(TagEXTXSESSIONKEY)+1:])
+	p.parseKeyAttributes(attrs, encryptInfo)
+
+	if encryptInfo.Method == entity.EncryptMethodNone {
+		return nil
+	}
+
+	if uri, ok := attrs["URI"]; ok {
+		encryptInfo.URI = p.resolveURL(strings.Trim(uri, `"`))
+		if p.isIdentityKeyFormat(encryptInfo.KeyFormat) || p.hasKeyProcessor(encryptInfo.URI, encryptInfo.KeyFormat) {
+			encryptInfo.Key = p.fetchKey(encryptInfo.URI, encryptInfo.KeyFormat)
+		}
+	}
+
+	return encryptInfo
+}
+
+// parseSessionData 解析EXT-X-SESSION-DATA
+func (p *HLSParser) parseSessionData(line string) *entity.SessionData {
+	if len(line) <= len(TagEXTXSESSIONDATA)+1 {
+		return nil
+	}
+	attrs := p.parseAttributes(line[len(TagEXTXSESSIONDATA)+1:])
+
+	dataID, ok := attrs["DATA-ID"]
+	if !ok {
+		return nil
+	}
+
+	data := &entity.SessionData{DataID: strings.Trim(dataID, `"`)}
+	if value, ok := attrs["VALUE"]; ok {
+		data.Value = strings.Trim(value, `"`)
+	}
+	if uri, ok := attrs["URI"]; ok {
+		data.URI = p.resolveURL(strings.Trim(uri, `"`))
+	}
+	if language, ok := attrs["LANGUAGE"]; ok {
+		data.Language = strings.Trim(language, `"`)
+	}
+
+	util.Logger.Debug("发现会话数据: %s=%s", data.DataID, data.Value)
+	return data
+}
 
+// isIdentityKeyFormat 判断KEYFORMAT是否为标准的identity格式
+func (p *HLSParser) isIdentityKeyFormat(keyFormat string) bool {
+	return keyFormat == "" || strings.EqualFold(keyFormat, "identity")
+}
+
+// hasKeyProcessor 判断是否有匹配的密钥处理器
+func (p *HLSParser) hasKeyProcessor(uri, keyFormat string) bool {
+	for _, processor := range p.keyProcessors {
+		if processor.CanProcess(uri, keyFormat) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyFormatSystemName 根据KEYFORMAT获取保护系统名称
+func keyFormatSystemName(keyFormat string) string {
+	switch strings.ToLower(keyFormat) {
+	case "", "identity":
+		return "AES"
+	case "com.apple.streamingkeydelivery":
+		return "FairPlay"
+	case "com.microsoft.playready":
+		return "PlayReady"
+	case "org.w3.clearkey":
+		return "ClearKey"
+	default:
+		if strings.HasPrefix(strings.ToLower(keyFormat), "urn:uuid:") {
+			return util.GetDRMSystemName(keyFormat)
+		}
+		return keyFormat
+	}
+}
+
+// parseKeyAttributes 解析EXT-X-KEY与EXT-X-SESSION-KEY共有的属性（不含URI）
+func (p *HLSParser) parseKeyAttributes(attrs map[string]string, encryptInfo *entity.EncryptInfo) {
 	if method, ok := attrs["METHOD"]; ok {
 		switch strings.ToUpper(method) {
 		case "AES-128":
 			encryptInfo.Method = entity.EncryptMethodAES128
+		case "AES-128-ECB":
+			encryptInfo.Method = entity.EncryptMethodAES128ECB
 		case "AES-CTR":
 			encryptInfo.Method = entity.EncryptMethodAESCTR
 		case "SAMPLE-AES":
 			encryptInfo.Method = entity.EncryptMethodSampleAES
+		case "SAMPLE-AES-CTR":
+			encryptInfo.Method = entity.EncryptMethodSampleAESCTR
 		case "NONE":
 			encryptInfo.Method = entity.EncryptMethodNone
 		}
 	}
 
-	if uri, ok := attrs["URI"]; ok {
-		encryptInfo.URI = p.resolveURL(strings.Trim(uri, `"`))
-		// 获取密钥
-		encryptInfo.Key = p.fetchKey(encryptInfo.URI)
+	if keyFormat, ok := attrs["KEYFORMAT"]; ok {
+		encryptInfo.KeyFormat = strings.Trim(keyFormat, `"`)
+	}
+
+	if keyFormatVersions, ok := attrs["KEYFORMATVERSIONS"]; ok {
+		encryptInfo.KeyFormatV = strings.Trim(keyFormatVersions, `"`)
 	}
 
 	if iv, ok := attrs["IV"]; ok {
@@ -571,8 +801,6 @@ func (p *HLSParser) parseKeyInfo(line string) *entity.EncryptInfo {
 			encryptInfo.IV = ivBytes
 		}
 	}
-
-	return encryptInfo
 }
 
 // parseMapInfo 解析MAP信息
@@ -636,11 +864,42 @@ func (p *HLSParser) resolveURL(urlStr string) string {
 }
 
 // fetchKey 获取加密密钥
-func (p *HLSParser) fetchKey(uri string) []byte {
+func (p *HLSParser) fetchKey(uri, keyFormat string) []byte {
 	if uri == "" {
 		return nil
 	}
 
+	if keyBytes, ok := p.keyCache[uri]; ok {
+		util.Logger.Debug("使用缓存的密钥: %s", uri)
+		return keyBytes
+	}
+
+	keyBytes := p.fetchKeyNoCache(uri, keyFormat)
+	if len(keyBytes) > 0 {
+		p.keyCache[uri] = keyBytes
+	}
+	return keyBytes
+}
+
+// fetchKeyNoCache 获取加密密钥（不使用缓存）
+func (p *HLSParser) fetchKeyNoCache(uri, keyFormat string) []byte {
+	// 优先使用匹配的密钥处理器
+	for _, processor := range p.keyProcessors {
+		if !processor.CanProcess(uri, keyFormat) {
+			continue
+		}
+		keyBytes, err := processor.Process(uri, keyFormat, p.headers)
+		if err != nil {
+			util.Logger.Warn("密钥处理器 %s 获取密钥失败: %s", processor.Name(), err.Error())
+			continue
+		}
+		if len(keyBytes) != 16 {
+			util.Logger.Warn("密钥处理器 %s 返回的密钥长度为 %d 字节", processor.Name(), len(keyBytes))
+		}
+		util.Logger.Debug("使用密钥处理器 %s 获取密钥: %s", processor.Name(), uri)
+		return keyBytes
+	}
+
 	// 处理base64编码的密钥
 	if strings.HasPrefix(strings.ToLower(uri), "base64:") {
 		if keyBytes, err := base64.StdEncoding.DecodeString(uri[7:]); err == nil {
@@ -0,0 +1,250 @@
+package parser
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"N_m3u8DL-RE-GO/internal/util"
+)
+
+// KeyProcessor HLS密钥处理器
+// 用于处理密钥接口返回JSON、十六进制文本或需要POST请求等非标准情况
+type KeyProcessor interface {
+	// Name 处理器名称
+	Name() string
+	// CanProcess 根据密钥URI和KEYFORMAT判断是否由该处理器处理
+	CanProcess(uri, keyFormat string) bool
+	// Process 获取并返回原始密钥字节
+	Process(uri, keyFormat string, headers map[string]string) ([]byte, error)
+}
+
+// NewKeyProcessor 根据参数创建密钥处理器
+// 格式: 名称[:参数=值[:参数=值]]，公共参数:
+//   - match: 匹配密钥URI的正则表达式
+//   - keyformat: 匹配的KEYFORMAT
+//   - xor: 十六进制掩码，获取到的密钥会与其逐字节异或
+//
+// 可用处理器:
+//   - json: field=JSON字段路径, encoding=base64|hex（默认base64）
+//   - hex: 响应内容为十六进制文本
+//   - post: body=请求体, content_type=请求类型, field=JSON字段路径（可选）, encoding=base64|hex
+func NewKeyProcessor(spec string) (KeyProcessor, error) {
+	name := strings.ToLower(strings.TrimSpace(strings.SplitN(spec, ":", 2)[0]))
+	params := util.NewComplexParamParser(spec)
+
+	base, err := newKeyProcessorBase(params)
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "json":
+		field := params.GetValue("field")
+		if field == "" {
+			return nil, fmt.Errorf("json密钥处理器缺少field参数")
+		}
+		return &JSONKeyProcessor{
+			keyProcessorBase: base,
+			field:            parseJSONPath(field),
+			encoding:         params.GetValue("encoding"),
+		}, nil
+	case "hex":
+		return &HexTextKeyProcessor{keyProcessorBase: base}, nil
+	case "post":
+		var field []string
+		if params.HasKey("field") {
+			field = parseJSONPath(params.GetValue("field"))
+		}
+		return &PostKeyProcessor{
+			keyProcessorBase: base,
+			body:             params.GetValue("body"),
+			contentType:      params.GetValue("content_type"),
+			field:            field,
+			encoding:         params.GetValue("encoding"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("不支持的密钥处理器: %s", name)
+	}
+}
+
+// keyProcessorBase 密钥处理器公共部分：匹配规则和异或掩码
+type keyProcessorBase struct {
+	uriRegex  *regexp.Regexp
+	keyFormat string
+	xorMask   []byte
+}
+
+// newKeyProcessorBase 解析公共参数
+func newKeyProcessorBase(params *util.ComplexParamParser) (keyProcessorBase, error) {
+	base := keyProcessorBase{keyFormat: params.GetValue("keyformat")}
+
+	if match := params.GetValue("match"); match != "" {
+		reg, err := regexp.Compile(match)
+		if err != nil {
+			return base, fmt.Errorf("密钥处理器match参数无效: %w", err)
+		}
+		base.uriRegex = reg
+	}
+
+	if xor := params.GetValue("xor"); xor != "" {
+		mask, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(xor), "0x"))
+		if err != nil || len(mask) == 0 {
+			return base, fmt.Errorf("密钥处理器xor参数无效: %s", xor)
+		}
+		base.xorMask = mask
+	}
+
+	return base, nil
+}
+
+// CanProcess 根据URI正则和KEYFORMAT判断是否匹配，均未设置时匹配所有HTTP密钥
+func (b keyProcessorBase) CanProcess(uri, keyFormat string) bool {
+	if b.keyFormat != "" && !strings.EqualFold(b.keyFormat, keyFormat) {
+		return false
+	}
+	if b.uriRegex != nil {
+		return b.uriRegex.MatchString(uri)
+	}
+	if b.keyFormat != "" {
+		return true
+	}
+	return strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://")
+}
+
+// finishKey 应用异或掩码
+func (b keyProcessorBase) finishKey(key []byte) []byte {
+	if len(b.xorMask) == 0 {
+		return key
+	}
+	result := make([]byte, len(key))
+	for i := range key {
+		result[i] = key[i] ^ b.xorMask[i%len(b.xorMask)]
+	}
+	return result
+}
+
+// decodeKeyText 按编码解码文本形式的密钥
+func decodeKeyText(text, encoding string) ([]byte, error) {
+	text = strings.TrimSpace(text)
+	switch strings.ToLower(encoding) {
+	case "hex":
+		return hex.DecodeString(strings.TrimPrefix(strings.ToLower(text), "0x"))
+	case "", "base64":
+		if key, err := base64.StdEncoding.DecodeString(text); err == nil {
+			return key, nil
+		}
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(text, "="))
+	default:
+		return nil, fmt.Errorf("不支持的密钥编码: %s", encoding)
+	}
+}
+
+// JSONKeyProcessor 从JSON响应的指定字段中读取密钥
+type JSONKeyProcessor struct {
+	keyProcessorBase
+	field    []string
+	encoding string
+}
+
+// Name 处理器名称
+func (p *JSONKeyProcessor) Name() string {
+	return "json"
+}
+
+// Process 获取密钥
+func (p *JSONKeyProcessor) Process(uri, keyFormat string, headers map[string]string) ([]byte, error) {
+	data, err := util.GetBytes(uri, headers)
+	if err != nil {
+		return nil, fmt.Errorf("请求密钥失败: %w", err)
+	}
+
+	value, err := lookupJSONString(data, p.field)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := decodeKeyText(value, p.encoding)
+	if err != nil {
+		return nil, fmt.Errorf("解码密钥失败: %w", err)
+	}
+	return p.finishKey(key), nil
+}
+
+// HexTextKeyProcessor 密钥接口返回十六进制文本
+type HexTextKeyProcessor struct {
+	keyProcessorBase
+}
+
+// Name 处理器名称
+func (p *HexTextKeyProcessor) Name() string {
+	return "hex"
+}
+
+// Process 获取密钥
+func (p *HexTextKeyProcessor) Process(uri, keyFormat string, headers map[string]string) ([]byte, error) {
+	data, err := util.GetBytes(uri, headers)
+	if err != nil {
+		return nil, fmt.Errorf("请求密钥失败: %w", err)
+	}
+
+	key, err := decodeKeyText(string(data), "hex")
+	if err != nil {
+		return nil, fmt.Errorf("解码十六进制密钥失败: %w", err)
+	}
+	return p.finishKey(key), nil
+}
+
+// PostKeyProcessor 通过POST请求获取密钥
+// 未设置field时响应内容即为原始密钥
+type PostKeyProcessor struct {
+	keyProcessorBase
+	body        string
+	contentType string
+	field       []string
+	encoding    string
+}
+
+// Name 处理器名称
+func (p *PostKeyProcessor) Name() string {
+	return "post"
+}
+
+// Process 获取密钥
+func (p *PostKeyProcessor) Process(uri, keyFormat string, headers map[string]string) ([]byte, error) {
+	reqHeaders := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		reqHeaders[k] = v
+	}
+	if p.contentType != "" {
+		reqHeaders["Content-Type"] = p.contentType
+	}
+
+	data, err := util.PostBytesWithHeaders(uri, []byte(p.body), reqHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("POST请求密钥失败: %w", err)
+	}
+
+	if len(p.field) == 0 {
+		if p.encoding != "" {
+			key, err := decodeKeyText(string(data), p.encoding)
+			if err != nil {
+				return nil, fmt.Errorf("解码密钥失败: %w", err)
+			}
+			return p.finishKey(key), nil
+		}
+		return p.finishKey(data), nil
+	}
+
+	value, err := lookupJSONString(data, p.field)
+	if err != nil {
+		return nil, err
+	}
+	key, err := decodeKeyText(value, p.encoding)
+	if err != nil {
+		return nil, fmt.Errorf("解码密钥失败: %w", err)
+	}
+	return p.finishKey(key), nil
+}
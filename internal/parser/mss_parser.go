@@ -129,6 +129,9 @@ func (p *MSSParser) ParseManifest(content, baseURL string, headers map[string]st
 	// 检查加密保护
 	isProtection := false
 	protectionSystemID := ""
+	protectionData := ""
+	protectionKID := ""
+	var protectionKIDs []string
 
 	if manifest.Protection != nil && manifest.Protection.ProtectionHeader != nil {
 		isProtection = true
@@ -136,6 +139,11 @@ func (p *MSSParser) ParseManifest(content, baseURL string, headers map[string]st
 		if protectionSystemID == "" {
 			protectionSystemID = "9A04F079-9840-4286-AB92-E65BE0885F95"
 		}
+		protectionData = strings.Join(strings.Fields(manifest.Protection.ProtectionHeader.Data), "")
+		protectionKIDs = p.parseProtectionHeader(protectionSystemID, protectionData)
+		if len(protectionKIDs) > 0 {
+			protectionKID = protectionKIDs[0]
+		}
 	}
 
 	// 处理每个StreamIndex
@@ -161,6 +169,7 @@ func (p *MSSParser) ParseManifest(content, baseURL string, headers map[string]st
 			stream.OriginalURL = baseURL
 
 			// 设置媒体类型
+			isText := strings.EqualFold(streamIndex.Type, "text")
 			switch strings.ToLower(streamIndex.Type) {
 			case "audio":
 				mediaType := entity.MediaTypeAudio
@@ -215,15 +224,15 @@ func (p *MSSParser) ParseManifest(content, baseURL string, headers map[string]st
 				stream.MSSData = &entity.MSSData{
 					FourCC:             qualityLevel.FourCC,
 					CodecPrivateData:   qualityLevel.CodecPrivateData,
-					Type:               streamIndex.Type,
+					Type:               strings.ToLower(streamIndex.Type),
 					Timescale:          timeScale,
 					Duration:           duration,
 					SamplingRate:       44100, // 默认值
 					Channels:           2,     // 默认值
 					BitsPerSample:      16,    // 默认值
 					NalUnitLengthField: 4,     // 默认值
-					IsProtection:       isProtection,
-					ProtectionData:     "", // TODO: 处理保护数据
+					IsProtection:       isProtection && !isText,
+					ProtectionData:     protectionData,
 					ProtectionSystemID: protectionSystemID,
 				}
 
@@ -324,12 +333,21 @@ func (p *MSSParser) ParseManifest(content, baseURL string, headers map[string]st
 			}
 
 			// 如果支持加密，设置加密信息
-			if isProtection && streamIndex.Type != "text" {
+			if isProtection && !isText {
+				stream.DefaultKID = protectionKID
+				stream.DRMInfos = []*entity.DRMInfo{{
+					SystemID: util.NormalizeSystemID(protectionSystemID),
+					Name:     util.GetDRMSystemName(protectionSystemID),
+					PRO:      protectionData,
+					KIDs:     protectionKIDs,
+				}}
 				if playlist.MediaInit != nil {
 					playlist.MediaInit.EncryptInfo.Method = entity.EncryptMethodCENC
+					playlist.MediaInit.EncryptInfo.KID = protectionKID
 				}
 				for _, segment := range mediaPart.MediaSegments {
 					segment.EncryptInfo.Method = entity.EncryptMethodCENC
+					segment.EncryptInfo.KID = protectionKID
 				}
 			}
 
@@ -351,6 +369,25 @@ func (p *MSSParser) ParseManifest(content, baseURL string, headers map[string]st
 	return streams, nil
 }
 
+// parseProtectionHeader 解析PlayReady保护头，返回CENC字节序的全部KID
+func (p *MSSParser) parseProtectionHeader(systemID, data string) []string {
+	if data == "" || util.NormalizeSystemID(systemID) != util.PlayReadySystemID {
+		return nil
+	}
+
+	header, err := util.ParsePlayReadyHeaderBase64(data)
+	if err != nil {
+		util.Logger.Warn("解析PlayReady保护头失败: %v", err)
+		return nil
+	}
+
+	util.Logger.Debug("PlayReady头版本: %s, KID: %s", header.Version, strings.Join(header.KIDs, ","))
+	if header.LAURL != "" {
+		util.Logger.Debug("PlayReady LA_URL: %s", header.LAURL)
+	}
+	return header.KIDs
+}
+
 // createSegment 创建媒体分段
 func (p *MSSParser) createSegment(urlPattern string, startTime, duration int64, timeScale float64, bitrate, index int) *entity.MediaSegment {
 	segment := entity.NewMediaSegment()
@@ -375,7 +412,8 @@ func (p *MSSParser) createSegment(urlPattern string, startTime, duration int64,
 
 // parseCodecs 解析编解码器信息
 func (p *MSSParser) parseCodecs(fourCC, privateData string) string {
-	if fourCC == "TTML" {
+	switch strings.ToUpper(fourCC) {
+	case "TTML", "DFXP":
 		return "stpp"
 	}
 
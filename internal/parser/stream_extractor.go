@@ -13,6 +13,10 @@ type StreamExtractor struct {
 	hlsParser  *HLSParser
 	mssParser  *MSSParser
 	dashParser *DASHParser
+
+	// 用户指定的内容处理器，先于默认处理器执行
+	contentProcessors        []ContentProcessor
+	defaultContentProcessors []ContentProcessor
 }
 
 // NewStreamExtractor 创建流提取器
@@ -20,7 +24,56 @@ func NewStreamExtractor() *StreamExtractor {
 	return &StreamExtractor{
 		hlsParser: NewHLSParser(),
 		mssParser: NewMSSParser(),
+		defaultContentProcessors: []ContentProcessor{
+			NewHLSRepairContentProcessor(),
+		},
+	}
+}
+
+// AddContentProcessor 添加内容处理器
+func (e *StreamExtractor) AddContentProcessor(processor ContentProcessor) {
+	e.contentProcessors = append(e.contentProcessors, processor)
+}
+
+// AddKeyProcessor 添加HLS密钥处理器
+func (e *StreamExtractor) AddKeyProcessor(processor KeyProcessor) {
+	e.hlsParser.AddKeyProcessor(processor)
+}
+
+// SetCustomHLSEncryption 设置自定义的HLS加密方法、密钥和IV
+func (e *StreamExtractor) SetCustomHLSEncryption(method *entity.EncryptMethod, key, iv []byte) {
+	e.hlsParser.SetCustomEncryption(method, key, iv)
+}
+
+// processContent 依次执行内容处理器
+// 先执行用户指定的处理器（如解开JSON/base64包装），再对处理后的内容判断类型，仅HLS清单执行默认处理器
+func (e *StreamExtractor) processContent(content, url string, headers map[string]string) (string, string) {
+	if content == "Live TS Stream detected" {
+		return content, url
+	}
+
+	content, url = e.runContentProcessors(e.contentProcessors, content, url, headers)
+	if e.detectExtractorType(content, url) == entity.ExtractorTypeHLS {
+		content, url = e.runContentProcessors(e.defaultContentProcessors, content, url, headers)
+	}
+	return content, url
+}
+
+// runContentProcessors 依次执行给定的内容处理器，处理失败时保留原内容并继续
+func (e *StreamExtractor) runContentProcessors(processors []ContentProcessor, content, url string, headers map[string]string) (string, string) {
+	for _, processor := range processors {
+		if !processor.CanProcess(content, url) {
+			continue
+		}
+		util.Logger.Debug("使用内容处理器: %s", processor.Name())
+		newContent, newURL, err := processor.Process(content, url, headers)
+		if err != nil {
+			util.Logger.Warn("内容处理器 %s 处理失败: %s", processor.Name(), err.Error())
+			continue
+		}
+		content, url = newContent, newURL
 	}
+	return content, url
 }
 
 // ExtractStreams 提取流信息
@@ -33,6 +86,8 @@ func (e *StreamExtractor) ExtractStreams(url string, headers map[string]string)
 		return nil, fmt.Errorf("获取内容失败: %w", err)
 	}
 
+	content, finalURL = e.processContent(content, finalURL, headers)
+
 	util.Logger.Debug(fmt.Sprintf("最终URL: %s", finalURL))
 	util.Logger.Debug(fmt.Sprintf("内容长度: %d", len(content)))
 
@@ -111,6 +166,7 @@ func (e *StreamExtractor) extractDASH(content, url string, headers map[string]st
 	if e.dashParser == nil {
 		e.dashParser = NewDASHParser(url)
 	}
+	e.dashParser.SetHeaders(headers)
 	return e.dashParser.Parse(content)
 }
 
@@ -150,38 +206,63 @@ func (e *StreamExtractor) extractLiveTS(url string, headers map[string]string) (
 	return []*entity.StreamSpec{stream}, nil
 }
 
-// FilterStreams 过滤流
-func (e *StreamExtractor) FilterStreams(streams []*entity.StreamSpec, videoSelect, audioSelect, subtitleSelect string) []*entity.StreamSpec {
+// FilterStreams 按视频、音频、字幕的选择条件分别过滤流，条件为nil时不选择该类型的流
+func (e *StreamExtractor) FilterStreams(streams []*entity.StreamSpec, videoFilter, audioFilter, subtitleFilter *entity.StreamFilter) []*entity.StreamSpec {
 	var filtered []*entity.StreamSpec
 
-	// 分类流
-	var videoStreams, audioStreams, subtitleStreams []*entity.StreamSpec
-
-	for _, stream := range streams {
-		if stream.MediaType != nil {
-			switch *stream.MediaType {
-			case entity.MediaTypeVideo:
-				videoStreams = append(videoStreams, stream)
-			case entity.MediaTypeAudio:
-				audioStreams = append(audioStreams, stream)
-			case entity.MediaTypeSubtitles:
-				subtitleStreams = append(subtitleStreams, stream)
-			}
-		}
-	}
+	videoStreams, audioStreams, subtitleStreams, _ := splitStreamsByType(streams)
 
 	// 应用视频选择
-	filtered = append(filtered, e.selectStreams(videoStreams, videoSelect)...)
+	filtered = append(filtered, util.DoFilterKeep(videoStreams, videoFilter)...)
 
 	// 应用音频选择
-	filtered = append(filtered, e.selectStreams(audioStreams, audioSelect)...)
+	filtered = append(filtered, util.DoFilterKeep(audioStreams, audioFilter)...)
 
 	// 应用字幕选择
-	filtered = append(filtered, e.selectStreams(subtitleStreams, subtitleSelect)...)
+	filtered = append(filtered, util.DoFilterKeep(subtitleStreams, subtitleFilter)...)
 
 	return filtered
 }
 
+// DropStreams 按视频、音频、字幕的排除条件分别排除流，条件为nil时不排除，其他类型的流保持不变
+func (e *StreamExtractor) DropStreams(streams []*entity.StreamSpec, videoFilter, audioFilter, subtitleFilter *entity.StreamFilter) []*entity.StreamSpec {
+	videoStreams, audioStreams, subtitleStreams, otherStreams := splitStreamsByType(streams)
+
+	var result []*entity.StreamSpec
+	result = append(result, util.DoFilterDrop(videoStreams, videoFilter)...)
+	result = append(result, util.DoFilterDrop(audioStreams, audioFilter)...)
+	result = append(result, util.DoFilterDrop(subtitleStreams, subtitleFilter)...)
+	return append(result, otherStreams...)
+}
+
+// splitStreamsByType 将流分为视频（含未知类型的基本流）、音频、字幕和其他类型
+func splitStreamsByType(streams []*entity.StreamSpec) (video, audio, subtitle, other []*entity.StreamSpec) {
+	for _, stream := range streams {
+		switch {
+		case stream.MediaType == nil || *stream.MediaType == entity.MediaTypeVideo:
+			video = append(video, stream)
+		case *stream.MediaType == entity.MediaTypeAudio:
+			audio = append(audio, stream)
+		case *stream.MediaType == entity.MediaTypeSubtitles:
+			subtitle = append(subtitle, stream)
+		default:
+			other = append(other, stream)
+		}
+	}
+	return video, audio, subtitle, other
+}
+
+// FilterImageStreams 选择缩略图流，未指定选择条件时不选择
+func (e *StreamExtractor) FilterImageStreams(streams []*entity.StreamSpec, imageSelect string) []*entity.StreamSpec {
+	var imageStreams []*entity.StreamSpec
+	for _, stream := range streams {
+		if stream.MediaType != nil && *stream.MediaType == entity.MediaTypeImages {
+			imageStreams = append(imageStreams, stream)
+		}
+	}
+	return e.selectStreams(imageStreams, imageSelect)
+}
+
 // selectStreams 选择流
 func (e *StreamExtractor) selectStreams(streams []*entity.StreamSpec, selection string) []*entity.StreamSpec {
 	if len(streams) == 0 {
@@ -262,6 +343,7 @@ func (e *StreamExtractor) FetchPlayList(streams []*entity.StreamSpec, headers ma
 			util.Logger.Warn(fmt.Sprintf("无法加载播放列表 %s: %v", stream.URL, err))
 			continue
 		}
+		content, finalURL = e.processContent(content, finalURL, headers)
 
 		// 解析播放列表
 		extractorType := e.detectExtractorType(content, finalURL)
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// clearKeyLicenseRequest W3C ClearKey许可证请求
+type clearKeyLicenseRequest struct {
+	Kids []string `json:"kids"`
+	Type string   `json:"type"`
+}
+
+// clearKeyLicenseResponse W3C ClearKey许可证响应（JWK Set）
+type clearKeyLicenseResponse struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		K   string `json:"k"`
+		Kid string `json:"kid"`
+	} `json:"keys"`
+	Type string `json:"type"`
+}
+
+// AcquireClearKeyLicense 向ClearKey许可证服务器请求密钥，返回 KID:KEY 格式的密钥列表
+func AcquireClearKeyLicense(licenseURL string, kids []string, headers map[string]string) ([]string, error) {
+	request := clearKeyLicenseRequest{Type: "temporary"}
+	for _, kid := range kids {
+		raw, err := hex.DecodeString(NormalizeKID(kid))
+		if err != nil || len(raw) != 16 {
+			return nil, fmt.Errorf("KID无效: %s", kid)
+		}
+		request.Kids = append(request.Kids, base64.RawURLEncoding.EncodeToString(raw))
+	}
+	if len(request.Kids) == 0 {
+		return nil, fmt.Errorf("没有需要请求的KID")
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("序列化ClearKey请求失败: %w", err)
+	}
+	data, err := PostBytesWithHeaders(licenseURL, body, headers)
+	if err != nil {
+		return nil, fmt.Errorf("请求ClearKey许可证失败: %w", err)
+	}
+	return ParseClearKeyLicense(data)
+}
+
+// ParseClearKeyLicense 解析ClearKey许可证响应中的keys数组
+func ParseClearKeyLicense(data []byte) ([]string, error) {
+	var response clearKeyLicenseResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("解析ClearKey许可证失败: %w", err)
+	}
+
+	var keys []string
+	for _, jwk := range response.Keys {
+		if jwk.Kty != "" && jwk.Kty != "oct" {
+			continue
+		}
+		kid, err := decodeBase64URL(jwk.Kid)
+		if err != nil || len(kid) != 16 {
+			return nil, fmt.Errorf("ClearKey许可证中的kid无效: %s", jwk.Kid)
+		}
+		key, err := decodeBase64URL(jwk.K)
+		if err != nil || len(key) != 16 {
+			return nil, fmt.Errorf("ClearKey许可证中KID %s 的密钥无效", hex.EncodeToString(kid))
+		}
+		keys = append(keys, hex.EncodeToString(kid)+":"+hex.EncodeToString(key))
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("ClearKey许可证中没有密钥")
+	}
+	return keys, nil
+}
+
+// decodeBase64URL 解码base64url，兼容带填充和标准字母表的输入
+func decodeBase64URL(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	s = strings.NewReplacer("+", "-", "/", "_").Replace(s)
+	return base64.RawURLEncoding.DecodeString(s)
+}
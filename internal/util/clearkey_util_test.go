@@ -0,0 +1,147 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAcquireClearKeyLicense(t *testing.T) {
+	licenseKeys := map[string]string{
+		"0102030405060708090a0b0c0d0e0f10": "00112233445566778899aabbccddeeff",
+		"a0a1a2a3a4a5a6a7a8a9aaabacadaeaf": "ffeeddccbbaa99887766554433221100",
+	}
+	encode := func(hexValue string) string {
+		raw, _ := hex.DecodeString(hexValue)
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+
+	var request clearKeyLicenseRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if got := r.Header.Get("X-Test"); got != "1" {
+			t.Errorf("X-Test header = %q, want %q", got, "1")
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("read request body: %v", err)
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Fatalf("request body is not JSON: %v", err)
+		}
+
+		var response clearKeyLicenseResponse
+		for _, kid := range request.Kids {
+			raw, err := base64.RawURLEncoding.DecodeString(kid)
+			if err != nil {
+				t.Errorf("kid %q is not unpadded base64url: %v", kid, err)
+				continue
+			}
+			key, ok := licenseKeys[hex.EncodeToString(raw)]
+			if !ok {
+				continue
+			}
+			response.Keys = append(response.Keys, struct {
+				Kty string `json:"kty"`
+				K   string `json:"k"`
+				Kid string `json:"kid"`
+			}{Kty: "oct", K: encode(key), Kid: kid})
+		}
+		response.Type = "temporary"
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	// KIDs in UUID form with upper case letters are normalized before encoding.
+	kids := []string{"01020304-0506-0708-090A-0B0C0D0E0F10", "a0a1a2a3a4a5a6a7a8a9aaabacadaeaf"}
+	keys, err := AcquireClearKeyLicense(server.URL, kids, map[string]string{"X-Test": "1"})
+	if err != nil {
+		t.Fatalf("AcquireClearKeyLicense: %v", err)
+	}
+
+	wantKids := []string{"AQIDBAUGBwgJCgsMDQ4PEA", "oKGio6SlpqeoqaqrrK2urw"}
+	if !reflect.DeepEqual(request.Kids, wantKids) {
+		t.Errorf("request kids = %v, want %v", request.Kids, wantKids)
+	}
+	if request.Type != "temporary" {
+		t.Errorf("request type = %q, want %q", request.Type, "temporary")
+	}
+
+	wantKeys := []string{
+		"0102030405060708090a0b0c0d0e0f10:00112233445566778899aabbccddeeff",
+		"a0a1a2a3a4a5a6a7a8a9aaabacadaeaf:ffeeddccbbaa99887766554433221100",
+	}
+	if !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("keys = %v, want %v", keys, wantKeys)
+	}
+}
+
+func TestAcquireClearKeyLicenseHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "denied", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	if _, err := AcquireClearKeyLicense(server.URL, []string{"0102030405060708090a0b0c0d0e0f10"}, nil); err == nil {
+		t.Fatal("expected an error for a 403 response")
+	}
+}
+
+func TestParseClearKeyLicense(t *testing.T) {
+	tests := []struct {
+		name    string
+		license string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "unpadded base64url",
+			license: `{"keys":[{"kty":"oct","kid":"AQIDBAUGBwgJCgsMDQ4PEA","k":"ABEiM0RVZneImaq7zN3u_w"}],"type":"temporary"}`,
+			want:    []string{"0102030405060708090a0b0c0d0e0f10:00112233445566778899aabbccddeeff"},
+		},
+		{
+			name:    "padded standard base64",
+			license: `{"keys":[{"kty":"oct","kid":"AQIDBAUGBwgJCgsMDQ4PEA==","k":"ABEiM0RVZneImaq7zN3u/w=="}]}`,
+			want:    []string{"0102030405060708090a0b0c0d0e0f10:00112233445566778899aabbccddeeff"},
+		},
+		{
+			name:    "non-symmetric keys are skipped",
+			license: `{"keys":[{"kty":"RSA","kid":"AQIDBAUGBwgJCgsMDQ4PEA","k":"ABEiM0RVZneImaq7zN3u_w"},{"kid":"oKGio6SlpqeoqaqrrK2urw","k":"ABEiM0RVZneImaq7zN3u_w"}]}`,
+			want:    []string{"a0a1a2a3a4a5a6a7a8a9aaabacadaeaf:00112233445566778899aabbccddeeff"},
+		},
+		{
+			name:    "short key",
+			license: `{"keys":[{"kty":"oct","kid":"AQIDBAUGBwgJCgsMDQ4PEA","k":"ABEiMw"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "no keys",
+			license: `{"keys":[]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON",
+			license: `not json`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClearKeyLicense([]byte(tt.license))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keys = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
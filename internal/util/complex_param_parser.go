@@ -25,8 +25,8 @@ func (p *ComplexParamParser) parse(input string) {
 		return
 	}
 
-	// 按冒号分割参数
-	parts := strings.Split(input, ":")
+	// 按冒号分割参数，引号内的冒号不作为分隔符
+	parts := splitOutsideQuotes(input, ':')
 	for _, part := range parts {
 		// 按等号分割键值对
 		kv := strings.SplitN(part, "=", 2)
@@ -35,13 +35,32 @@ func (p *ComplexParamParser) parse(input string) {
 			value := strings.TrimSpace(kv[1])
 			// 去除引号
 			if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
-				value = value[1 : len(value)-1]
+				value = strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
 			}
 			p.params[key] = value
 		}
 	}
 }
 
+// splitOutsideQuotes 按分隔符分割字符串，忽略双引号内的分隔符
+func splitOutsideQuotes(input string, sep byte) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(input); i++ {
+		switch {
+		case input[i] == '\\' && inQuotes:
+			i++
+		case input[i] == '"':
+			inQuotes = !inQuotes
+		case input[i] == sep && !inQuotes:
+			parts = append(parts, input[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, input[start:])
+}
+
 // GetValue 获取参数值
 func (p *ComplexParamParser) GetValue(key string) string {
 	return p.params[key]
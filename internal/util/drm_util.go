@@ -0,0 +1,60 @@
+package util
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// DRM系统ID
+const (
+	WidevineSystemID  = "edef8ba9-79d6-4ace-a3c8-27dcd51d21ed"
+	PlayReadySystemID = "9a04f079-9840-4286-ab92-e65be0885f95"
+	FairPlaySystemID  = "94ce86fb-07ff-4f43-adb8-93d2fa968ca2"
+	ClearKeySystemID  = "e2719d58-a985-b3c9-781a-b030af78d30e"
+	CommonSystemID    = "1077efec-c0b2-4d02-ace3-3c1e52e2fb4b"
+	MarlinSystemID    = "5e629af5-38da-4063-8977-97ffbd9902d4"
+)
+
+var drmSystemNames = map[string]string{
+	WidevineSystemID:  "Widevine",
+	PlayReadySystemID: "PlayReady",
+	FairPlaySystemID:  "FairPlay",
+	ClearKeySystemID:  "ClearKey",
+	CommonSystemID:    "Common",
+	MarlinSystemID:    "Marlin",
+}
+
+// NormalizeSystemID 将系统ID统一为小写带短横线的UUID格式，支持urn:uuid:前缀和无短横线格式
+func NormalizeSystemID(systemID string) string {
+	id := strings.ToLower(strings.TrimSpace(systemID))
+	id = strings.TrimPrefix(id, "urn:uuid:")
+	id = strings.Trim(id, "{}")
+	raw := strings.ReplaceAll(id, "-", "")
+	if len(raw) != 32 {
+		return id
+	}
+	return raw[0:8] + "-" + raw[8:12] + "-" + raw[12:16] + "-" + raw[16:20] + "-" + raw[20:32]
+}
+
+// GetDRMSystemName 获取DRM系统名称，未知系统返回规范化后的ID
+func GetDRMSystemName(systemID string) string {
+	id := NormalizeSystemID(systemID)
+	if name, ok := drmSystemNames[id]; ok {
+		return name
+	}
+	return id
+}
+
+// NormalizeKID 将KID统一为32位小写十六进制，无效时返回空字符串
+func NormalizeKID(kid string) string {
+	raw := strings.ToLower(strings.TrimSpace(kid))
+	raw = strings.Trim(raw, "{}")
+	raw = strings.ReplaceAll(raw, "-", "")
+	if len(raw) != 32 {
+		return ""
+	}
+	if _, err := hex.DecodeString(raw); err != nil {
+		return ""
+	}
+	return raw
+}
@@ -0,0 +1,293 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"N_m3u8DL-RE-GO/internal/entity"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+)
+
+// EncryptionReport 选中流的加密检查报告
+type EncryptionReport struct {
+	Streams []*StreamEncryptionReport `json:"streams"`
+}
+
+// StreamEncryptionReport 单个流的加密信息
+type StreamEncryptionReport struct {
+	Stream     string                  `json:"stream"`
+	URL        string                  `json:"url,omitempty"`
+	Encrypted  bool                    `json:"encrypted"`
+	Scheme     string                  `json:"scheme,omitempty"` // 初始化段schm中的保护方案
+	Parts      []*PartEncryptionReport `json:"parts"`
+	KIDs       []*KIDStatus            `json:"kids,omitempty"`
+	DRMSystems []*DRMSystemReport      `json:"drmSystems,omitempty"`
+}
+
+// PartEncryptionReport 单个MediaPart的加密信息
+type PartEncryptionReport struct {
+	Index             int      `json:"index"`
+	PeriodID          string   `json:"periodId,omitempty"`
+	Segments          int      `json:"segments"`
+	EncryptedSegments int      `json:"encryptedSegments"`
+	Methods           []string `json:"methods"`
+	KeyURIs           []string `json:"keyUris,omitempty"`
+	KeyFormats        []string `json:"keyFormats,omitempty"`
+	HasKey            bool     `json:"hasKey"` // 解密该部分所需的密钥是否都已持有
+}
+
+// KIDStatus KID及是否已持有对应密钥
+type KIDStatus struct {
+	KID    string `json:"kid"`
+	HasKey bool   `json:"hasKey"`
+}
+
+// DRMSystemReport 清单或初始化段中声明的DRM系统
+type DRMSystemReport struct {
+	SystemID   string   `json:"systemId"`
+	Name       string   `json:"name"`
+	Source     string   `json:"source"` // manifest或init
+	KIDs       []string `json:"kids,omitempty"`
+	LicenseURL string   `json:"licenseUrl,omitempty"`
+}
+
+// InspectEncryption 汇总选中流的加密信息：分段的EncryptInfo、DASH/MSS的保护信息以及初始化段中的tenc/pssh
+// hasKey用于判断是否已持有某个KID的密钥
+func InspectEncryption(streams []*entity.StreamSpec, headers map[string]string, hasKey func(kid string) bool) *EncryptionReport {
+	report := &EncryptionReport{}
+	for _, stream := range streams {
+		report.Streams = append(report.Streams, inspectStreamEncryption(stream, headers, hasKey))
+	}
+	return report
+}
+
+// inspectStreamEncryption 检查单个流
+func inspectStreamEncryption(stream *entity.StreamSpec, headers map[string]string, hasKey func(kid string) bool) *StreamEncryptionReport {
+	report := &StreamEncryptionReport{
+		Stream: stream.ToShortString(),
+		URL:    stream.URL,
+	}
+
+	var kids []string
+	// kidParts 通用加密的部分，是否持有密钥取决于该部分分段实际使用的KID
+	var kidParts []*PartEncryptionReport
+	partKIDs := make(map[*PartEncryptionReport][]string)
+	// trackKIDs 轨道加密使用的KID（tenc或清单default_KID），分段未声明KID时使用
+	var trackKIDs []string
+	kids = appendUniqueKID(kids, stream.DefaultKID)
+	for _, info := range stream.DRMInfos {
+		report.DRMSystems = append(report.DRMSystems, &DRMSystemReport{
+			SystemID:   info.SystemID,
+			Name:       info.Name,
+			Source:     "manifest",
+			KIDs:       info.KIDs,
+			LicenseURL: info.LicenseURL,
+		})
+		for _, kid := range info.KIDs {
+			kids = appendUniqueKID(kids, kid)
+		}
+	}
+
+	if stream.Playlist != nil {
+		if mp4Info := inspectInitSegment(stream.Playlist.MediaInit, headers); mp4Info != nil {
+			report.Scheme = mp4Info.Scheme
+			for _, pssh := range mp4Info.PSSH {
+				report.DRMSystems = append(report.DRMSystems, &DRMSystemReport{
+					SystemID: pssh.SystemID,
+					Name:     pssh.Name,
+					Source:   "init",
+					KIDs:     pssh.KIDs,
+				})
+			}
+			for _, kid := range mp4Info.KIDs {
+				kids = appendUniqueKID(kids, kid)
+			}
+			for _, kid := range mp4Info.TencKIDs {
+				trackKIDs = appendUniqueKID(trackKIDs, kid)
+			}
+		}
+		if len(trackKIDs) == 0 {
+			trackKIDs = appendUniqueKID(trackKIDs, stream.DefaultKID)
+		}
+
+		for i, part := range stream.Playlist.MediaParts {
+			partReport := &PartEncryptionReport{
+				Index:    i,
+				PeriodID: part.PeriodID,
+				Segments: len(part.MediaSegments),
+				HasKey:   true,
+			}
+			for _, seg := range part.MediaSegments {
+				info := seg.EncryptInfo
+				if info == nil {
+					info = entity.NewEncryptInfo()
+				}
+				partReport.Methods = appendUniqueString(partReport.Methods, info.Method.String())
+				if !info.IsEncrypted() {
+					continue
+				}
+				partReport.EncryptedSegments++
+				partReport.KeyURIs = appendUniqueString(partReport.KeyURIs, info.URI)
+				partReport.KeyFormats = appendUniqueString(partReport.KeyFormats, info.KeyFormat)
+				kids = appendUniqueKID(kids, info.KID)
+				if info.Method.IsCommonEncryption() {
+					kidParts = appendUniquePart(kidParts, partReport)
+					partKIDs[partReport] = appendUniqueKID(partKIDs[partReport], info.KID)
+				} else if len(info.Key) == 0 {
+					partReport.HasKey = false
+				}
+			}
+			report.Parts = append(report.Parts, partReport)
+			report.Encrypted = report.Encrypted || partReport.EncryptedSegments > 0
+		}
+	}
+
+	for _, kid := range kids {
+		report.KIDs = append(report.KIDs, &KIDStatus{KID: kid, HasKey: hasKey != nil && hasKey(kid)})
+	}
+	for _, part := range kidParts {
+		usedKIDs := partKIDs[part]
+		if len(usedKIDs) == 0 {
+			usedKIDs = trackKIDs
+		}
+		if len(usedKIDs) == 0 {
+			// 无法确定该部分使用的KID时，要求持有全部已知KID的密钥
+			usedKIDs = kids
+		}
+		part.HasKey = part.HasKey && allKIDsHaveKey(usedKIDs, hasKey)
+	}
+	report.Encrypted = report.Encrypted || report.Scheme != "" || len(report.DRMSystems) > 0
+	return report
+}
+
+// inspectInitSegment 下载初始化段并解析其中的tenc、pssh和schm，失败时返回nil
+func inspectInitSegment(init *entity.MediaSegment, headers map[string]string) *ParsedMP4Info {
+	// MSS的初始化段只是占位，没有可下载的内容
+	if init == nil || init.URL == "" {
+		return nil
+	}
+
+	var data []byte
+	var err error
+	if init.StartRange != nil {
+		data, err = GetBytesRange(init.URL, headers, *init.StartRange, init.ExpectLength)
+	} else {
+		data, err = GetBytes(init.URL, headers)
+	}
+	if err != nil {
+		Logger.Warn("下载初始化段失败: %v", err)
+		return nil
+	}
+
+	info, err := GetMP4InfoFromBytes(data)
+	if err != nil {
+		Logger.Debug("解析初始化段失败: %v", err)
+		return nil
+	}
+	return info
+}
+
+// allKIDsHaveKey 所有KID是否都已持有密钥，没有KID时视为无法确认
+func allKIDsHaveKey(kids []string, hasKey func(kid string) bool) bool {
+	if len(kids) == 0 || hasKey == nil {
+		return false
+	}
+	for _, kid := range kids {
+		if !hasKey(kid) {
+			return false
+		}
+	}
+	return true
+}
+
+// appendUniquePart 去重追加MediaPart报告
+func appendUniquePart(parts []*PartEncryptionReport, part *PartEncryptionReport) []*PartEncryptionReport {
+	for _, p := range parts {
+		if p == part {
+			return parts
+		}
+	}
+	return append(parts, part)
+}
+
+// appendUniqueString 去重追加非空字符串
+func appendUniqueString(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// PrintEncryptionReport 以表格形式输出加密检查报告，每个MediaPart一行
+func PrintEncryptionReport(report *EncryptionReport) {
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		Headers("流", "部分", "加密方法", "KEYFORMAT", "密钥URI", "KID", "DRM系统", "密钥")
+
+	for _, stream := range report.Streams {
+		var kids []string
+		for _, kid := range stream.KIDs {
+			status := "缺失"
+			if kid.HasKey {
+				status = "已有"
+			}
+			kids = append(kids, fmt.Sprintf("%s (%s)", kid.KID, status))
+		}
+		var systems []string
+		for _, system := range stream.DRMSystems {
+			systems = appendUniqueString(systems, system.Name)
+		}
+		if stream.Scheme != "" {
+			systems = append(systems, "scheme: "+stream.Scheme)
+		}
+
+		parts := stream.Parts
+		if len(parts) == 0 {
+			parts = []*PartEncryptionReport{{Methods: []string{entity.EncryptMethodNone.String()}}}
+		}
+		for i, part := range parts {
+			name, kidCol, systemCol := "", "", ""
+			if i == 0 {
+				name = stream.Stream
+				kidCol = strings.Join(kids, "\n")
+				systemCol = strings.Join(systems, "\n")
+			}
+			keyCol := "-"
+			if part.EncryptedSegments > 0 {
+				keyCol = "缺失"
+				if part.HasKey {
+					keyCol = "已有"
+				}
+			}
+			partCol := fmt.Sprintf("%d (%d/%d)", part.Index, part.EncryptedSegments, part.Segments)
+			if part.PeriodID != "" {
+				partCol += "\n" + part.PeriodID
+			}
+			t.Row(name, partCol, strings.Join(part.Methods, ", "), strings.Join(part.KeyFormats, "\n"),
+				strings.Join(part.KeyURIs, "\n"), kidCol, systemCol, keyCol)
+		}
+	}
+
+	fmt.Println(t.Render())
+}
+
+// WriteEncryptionReport 将加密检查报告写出为JSON文件
+func WriteEncryptionReport(report *EncryptionReport, path string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化加密检查报告失败: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("写入%s失败: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"N_m3u8DL-RE-GO/internal/entity"
+)
+
+var (
+	scte35BinaryReg        = regexp.MustCompile(`<(?:\w+:)?Binary[^>]*>\s*([A-Za-z0-9+/=\s]+?)\s*</`)
+	scte35OutOfNetworkReg  = regexp.MustCompile(`outOfNetworkIndicator="(?:true|1)"`)
+	scte35BreakDurationReg = regexp.MustCompile(`<(?:\w+:)?BreakDuration[^>]*\sduration="(\d+)"`)
+	scte35SegTypeReg       = regexp.MustCompile(`segmentationTypeId="(\d+)"`)
+	scte35SegDurationReg   = regexp.MustCompile(`segmentationDuration="(\d+)"`)
+)
+
+// ClassifyEvent 根据schemeIdUri识别事件类型，并解析SCTE-35广告插入点
+// data为事件的原始消息内容
+func ClassifyEvent(event *entity.MediaEvent, data []byte) {
+	scheme := strings.ToLower(event.SchemeIDURI)
+	switch {
+	case strings.HasPrefix(scheme, "urn:scte:scte35:"):
+		event.Type = entity.EventTypeSCTE35
+		classifySCTE35Event(event, scheme, data)
+	case strings.Contains(scheme, "id3"):
+		event.Type = entity.EventTypeID3
+		event.Data = base64.StdEncoding.EncodeToString(data)
+	default:
+		event.Type = entity.EventTypeOther
+		event.Data = eventDataString(data)
+	}
+}
+
+// classifySCTE35Event 解析SCTE-35的XML或二进制形式
+func classifySCTE35Event(event *entity.MediaEvent, scheme string, data []byte) {
+	text := strings.TrimSpace(string(data))
+
+	var binaryData []byte
+	if strings.HasSuffix(scheme, ":bin") {
+		if decoded, err := base64.StdEncoding.DecodeString(text); err == nil {
+			binaryData = decoded
+		} else if len(data) > 0 && data[0] == 0xFC {
+			binaryData = data
+		}
+	} else if match := scte35BinaryReg.FindStringSubmatch(text); match != nil {
+		binaryData, _ = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(match[1]), ""))
+	}
+
+	if binaryData != nil {
+		event.Data = base64.StdEncoding.EncodeToString(binaryData)
+		info, err := ParseSCTE35(binaryData)
+		if err != nil {
+			Logger.Debug("解析SCTE-35失败: %s", err.Error())
+			return
+		}
+		event.IsAdBreak = info.IsAdBreakStart()
+		if event.Duration == 0 {
+			event.Duration = info.Duration()
+		}
+		return
+	}
+
+	// XML形式
+	event.Data = text
+	if scte35OutOfNetworkReg.MatchString(text) {
+		event.IsAdBreak = true
+		if match := scte35BreakDurationReg.FindStringSubmatch(text); match != nil && event.Duration == 0 {
+			if ticks, err := strconv.ParseInt(match[1], 10, 64); err == nil {
+				event.Duration = float64(ticks) / 90000
+			}
+		}
+	}
+	if match := scte35SegTypeReg.FindStringSubmatch(text); match != nil {
+		if typeID, err := strconv.Atoi(match[1]); err == nil && IsSCTE35AdStartType(typeID) {
+			event.IsAdBreak = true
+			if match := scte35SegDurationReg.FindStringSubmatch(text); match != nil && event.Duration == 0 {
+				if ticks, err := strconv.ParseInt(match[1], 10, 64); err == nil {
+					event.Duration = float64(ticks) / 90000
+				}
+			}
+		}
+	}
+}
+
+// eventDataString 可打印的内容原样保存，否则转为base64
+func eventDataString(data []byte) string {
+	for _, b := range data {
+		if b < 0x09 || (b > 0x0d && b < 0x20) {
+			return base64.StdEncoding.EncodeToString(data)
+		}
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// SegmentStartTimes 计算播放列表中每个分片在演示时间轴上的起始时间（秒）
+// 优先使用解析时记录的起始时间，不受之后移除分片或Period的影响；未记录时按前一分片累加时长
+func SegmentStartTimes(playlist *entity.Playlist) map[int64]float64 {
+	startTimes := make(map[int64]float64)
+	if playlist == nil {
+		return startTimes
+	}
+	var current float64
+	for _, part := range playlist.MediaParts {
+		for _, segment := range part.MediaSegments {
+			if segment.StartTime != nil {
+				current = *segment.StartTime
+			}
+			startTimes[segment.Index] = current
+			current += segment.Duration
+		}
+	}
+	return startTimes
+}
+
+// AdBreakOverlaps 判断时间段是否与任一广告事件重叠
+func AdBreakOverlaps(events []*entity.MediaEvent, start, end float64) bool {
+	const epsilon = 0.001
+	for _, event := range events {
+		if !event.IsAdBreak || event.Duration <= 0 {
+			continue
+		}
+		if start < event.EndTime()-epsilon && end > event.StartTime+epsilon {
+			return true
+		}
+	}
+	return false
+}
+
+// CleanAdEvents 根据广告事件移除对应时间段的分片，与CleanAd的处理方式一致
+func CleanAdEvents(selectedStreams []*entity.StreamSpec) {
+	for _, stream := range selectedStreams {
+		if stream.Playlist == nil || len(stream.Events) == 0 {
+			continue
+		}
+
+		countBefore := stream.GetSegmentsCount()
+		startTimes := SegmentStartTimes(stream.Playlist)
+
+		var newParts []*entity.MediaPart
+		for _, part := range stream.Playlist.MediaParts {
+			var newSegments []*entity.MediaSegment
+			for _, segment := range part.MediaSegments {
+				start := startTimes[segment.Index]
+				if !AdBreakOverlaps(stream.Events, start, start+segment.Duration) {
+					newSegments = append(newSegments, segment)
+				}
+			}
+			part.MediaSegments = newSegments
+			if len(part.MediaSegments) > 0 {
+				newParts = append(newParts, part)
+			}
+		}
+		stream.Playlist.MediaParts = newParts
+
+		countAfter := stream.GetSegmentsCount()
+		if countBefore != countAfter {
+			Logger.Warn("按广告事件过滤后段数变化: %d => %d", countBefore, countAfter)
+		}
+	}
+}
+
+// CollectEvents 汇总多个流中的事件，去重后按时间排序
+func CollectEvents(streams []*entity.StreamSpec) []*entity.MediaEvent {
+	seen := make(map[string]bool)
+	var events []*entity.MediaEvent
+	for _, stream := range streams {
+		for _, event := range stream.Events {
+			key := fmt.Sprintf("%s|%s|%s|%.3f", event.SchemeIDURI, event.Value, event.ID, event.StartTime)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StartTime < events[j].StartTime
+	})
+	return events
+}
+
+// WriteEventsJSON 写出事件列表
+func WriteEventsJSON(filePath string, events []*entity.MediaEvent) error {
+	data, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化事件失败: %w", err)
+	}
+	return WriteFile(filePath, data)
+}
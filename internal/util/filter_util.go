@@ -48,6 +48,9 @@ func DoFilterKeep(streams []*entity.StreamSpec, filter *entity.StreamFilter) []*
 		if filter.VideoRangeReg != nil && (stream.VideoRange == "" || !filter.VideoRangeReg.MatchString(stream.VideoRange)) {
 			match = false
 		}
+		if filter.CharacteristicsReg != nil && (stream.Characteristics == "" || !filter.CharacteristicsReg.MatchString(stream.Characteristics)) {
+			match = false
+		}
 		if filter.UrlReg != nil && (stream.URL == "" || !filter.UrlReg.MatchString(stream.URL)) {
 			match = false
 		}
@@ -492,6 +495,8 @@ func getMediaTypeOrder(mediaType *entity.MediaType) int {
 		return 1 // 音频流
 	case entity.MediaTypeSubtitles:
 		return 2 // 字幕流
+	case entity.MediaTypeImages:
+		return 3 // 缩略图
 	default:
 		return 0
 	}
@@ -522,3 +527,40 @@ func SelectStreams(streams []*entity.StreamSpec) []*entity.StreamSpec {
 	// 使用交互式选择器并调用新的函数
 	return SelectStreamsInteractive(sortedStreams)
 }
+
+// FilterPeriods 按Period过滤分片
+// periodReg不为空时只保留PeriodID匹配的部分，dropAd为true时移除疑似广告的Period
+func FilterPeriods(selectedStreams []*entity.StreamSpec, periodReg *regexp.Regexp, dropAd bool) {
+	if periodReg == nil && !dropAd {
+		return
+	}
+
+	for _, stream := range selectedStreams {
+		if stream.Playlist == nil {
+			continue
+		}
+
+		countBefore := stream.GetSegmentsCount()
+
+		var newParts []*entity.MediaPart
+		for _, part := range stream.Playlist.MediaParts {
+			periodID := part.PeriodID
+			if periodID == "" {
+				periodID = stream.PeriodID
+			}
+			if periodReg != nil && !periodReg.MatchString(periodID) {
+				continue
+			}
+			if dropAd && part.IsAd {
+				continue
+			}
+			newParts = append(newParts, part)
+		}
+		stream.Playlist.MediaParts = newParts
+
+		countAfter := stream.GetSegmentsCount()
+		if countBefore != countAfter {
+			Logger.Warn("按Period过滤后段数变化: %d => %d", countBefore, countAfter)
+		}
+	}
+}
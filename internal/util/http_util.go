@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -148,29 +150,178 @@ func (h *HTTPUtil) GetBytes(urlStr string, headers map[string]string) ([]byte, e
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	reader, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
 
-	var reader io.Reader = resp.Body
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
 
-	// 处理 gzip 压缩
-	if strings.Contains(strings.ToLower(resp.Header.Get("Content-Encoding")), "gzip") {
-		gzipReader, err := gzip.NewReader(resp.Body)
+	Logger.Debug(fmt.Sprintf("获取到 %d 字节数据", len(data)))
+	return data, nil
+}
+
+// GetStream 获取响应体流，不把整个响应读入内存，调用方负责关闭
+func (h *HTTPUtil) GetStream(urlStr string, headers map[string]string) (io.ReadCloser, error) {
+	if strings.HasPrefix(urlStr, "file:") {
+		return openFileURL(urlStr)
+	}
+
+	resp, err := h.doGet(urlStr, headers)
+	if err != nil {
+		return nil, err
+	}
+	return responseBody(resp)
+}
+
+// GetStreamRange 按字节范围获取响应体流，expectLength为nil时读取到文件末尾
+// 服务器须返回206且Content-Range与请求一致；忽略Range返回200时从完整响应中截取对应部分
+func (h *HTTPUtil) GetStreamRange(urlStr string, headers map[string]string, start int64, expectLength *int64) (io.ReadCloser, error) {
+	if strings.HasPrefix(urlStr, "file:") {
+		file, err := openFileURL(urlStr)
+		if err != nil {
+			return nil, err
+		}
+		info, err := file.Stat()
 		if err != nil {
-			return nil, fmt.Errorf("创建gzip reader失败: %v", err)
+			file.Close()
+			return nil, err
 		}
-		defer gzipReader.Close()
-		reader = gzipReader
+		if start > info.Size() {
+			file.Close()
+			return nil, fmt.Errorf("范围起点 %d 超出文件大小 %d", start, info.Size())
+		}
+		if _, err := file.Seek(start, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if expectLength == nil {
+			return file, nil
+		}
+		return &readCloser{Reader: io.LimitReader(file, *expectLength), Closer: file}, nil
 	}
 
-	data, err := io.ReadAll(reader)
+	rangeHeaders := make(map[string]string, len(headers)+2)
+	for k, v := range headers {
+		rangeHeaders[k] = v
+	}
+	rangeHeaders["Range"] = RangeHeaderValue(start, expectLength)
+	// 字节范围针对未压缩的内容
+	rangeHeaders["Accept-Encoding"] = "identity"
+
+	resp, err := h.doGet(urlStr, rangeHeaders)
 	if err != nil {
 		return nil, err
 	}
 
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if err := checkContentRange(resp.Header.Get("Content-Range"), start, expectLength); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	case http.StatusOK:
+		// 服务器忽略了Range，跳过起点之前的数据
+		Logger.Debug("服务器未按Range返回部分内容，从完整响应中截取: %s", urlStr)
+		if _, err := io.CopyN(io.Discard, resp.Body, start); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("范围起点 %d 超出响应大小: %w", start, err)
+		}
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("范围请求返回了意外的状态: HTTP %s", resp.Status)
+	}
+
+	body, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if expectLength == nil {
+		return body, nil
+	}
+	return &readCloser{Reader: io.LimitReader(body, *expectLength), Closer: body}, nil
+}
+
+// checkContentRange 校验206响应的Content-Range与请求的范围一致
+// 请求范围超出文件末尾时服务器可以截短，其余不一致视为错误
+func checkContentRange(contentRange string, start int64, expectLength *int64) error {
+	var first, last int64
+	var total string
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &first, &last, &total); err != nil {
+		return fmt.Errorf("无效的Content-Range: %q", contentRange)
+	}
+	if first != start {
+		return fmt.Errorf("Content-Range %q 与请求的起点 %d 不一致", contentRange, start)
+	}
+	if expectLength == nil || *expectLength <= 0 {
+		return nil
+	}
+	wantLast := start + *expectLength - 1
+	if last == wantLast {
+		return nil
+	}
+	if size, err := strconv.ParseInt(total, 10, 64); err == nil && last < wantLast && last == size-1 {
+		return nil
+	}
+	return fmt.Errorf("Content-Range %q 与请求的范围 %d-%d 不一致", contentRange, start, wantLast)
+}
+
+// openFileURL 打开file:协议的本地文件
+func openFileURL(urlStr string) (*os.File, error) {
+	fileURL, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fileURL.Path)
+}
+
+// readCloser 组合Reader和Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// responseBody 返回响应体，gzip压缩的响应会自动解压，关闭时关闭原始响应体
+func responseBody(resp *http.Response) (io.ReadCloser, error) {
+	if !strings.Contains(strings.ToLower(resp.Header.Get("Content-Encoding")), "gzip") {
+		return resp.Body, nil
+	}
+	gzipReader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("创建gzip reader失败: %v", err)
+	}
+	return &readCloser{Reader: gzipReader, Closer: resp.Body}, nil
+}
+
+// GetBytesRange 按字节范围获取数据，expectLength为nil时读取到文件末尾
+func (h *HTTPUtil) GetBytesRange(urlStr string, headers map[string]string, start int64, expectLength *int64) ([]byte, error) {
+	body, err := h.GetStreamRange(urlStr, headers, start, expectLength)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
 	Logger.Debug(fmt.Sprintf("获取到 %d 字节数据", len(data)))
 	return data, nil
 }
 
+// RangeHeaderValue 生成Range请求头的值
+func RangeHeaderValue(start int64, expectLength *int64) string {
+	if expectLength == nil || *expectLength <= 0 {
+		return fmt.Sprintf("bytes=%d-", start)
+	}
+	return fmt.Sprintf("bytes=%d-%d", start, start+*expectLength-1)
+}
+
 // GetString 获取字符串源码
 func (h *HTTPUtil) GetString(urlStr string, headers map[string]string) (string, error) {
 	resp, err := h.doGet(urlStr, headers)
@@ -267,6 +418,31 @@ func (h *HTTPUtil) PostBytes(urlStr string, postData []byte) (string, error) {
 	return string(data), nil
 }
 
+// PostBytesWithHeaders 发送带自定义headers的POST请求，返回响应字节
+func (h *HTTPUtil) PostBytesWithHeaders(urlStr string, postData []byte, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequest("POST", urlStr, strings.NewReader(string(postData)))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
 // isMPEGTS 检查是否是MPEG-TS流
 func (h *HTTPUtil) isMPEGTS(resp *http.Response) bool {
 	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
@@ -306,6 +482,18 @@ func GetBytes(urlStr string, headers map[string]string) ([]byte, error) {
 	return DefaultHTTPUtil.GetBytes(urlStr, headers)
 }
 
+func GetBytesRange(urlStr string, headers map[string]string, start int64, expectLength *int64) ([]byte, error) {
+	return DefaultHTTPUtil.GetBytesRange(urlStr, headers, start, expectLength)
+}
+
+func GetStream(urlStr string, headers map[string]string) (io.ReadCloser, error) {
+	return DefaultHTTPUtil.GetStream(urlStr, headers)
+}
+
+func GetStreamRange(urlStr string, headers map[string]string, start int64, expectLength *int64) (io.ReadCloser, error) {
+	return DefaultHTTPUtil.GetStreamRange(urlStr, headers, start, expectLength)
+}
+
 func GetString(urlStr string, headers map[string]string) (string, error) {
 	return DefaultHTTPUtil.GetString(urlStr, headers)
 }
@@ -318,6 +506,10 @@ func PostBytes(urlStr string, postData []byte) (string, error) {
 	return DefaultHTTPUtil.PostBytes(urlStr, postData)
 }
 
+func PostBytesWithHeaders(urlStr string, postData []byte, headers map[string]string) ([]byte, error) {
+	return DefaultHTTPUtil.PostBytesWithHeaders(urlStr, postData, headers)
+}
+
 func Do(req *http.Request) (*http.Response, error) {
 	return DefaultHTTPUtil.Do(req)
 }
@@ -0,0 +1,422 @@
+package util
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 密钥库文件格式
+const (
+	KeyStoreFormatText = "text"
+	KeyStoreFormatJSON = "json"
+	KeyStoreFormatCSV  = "csv"
+)
+
+// KeyEntry 密钥库中的一条记录
+type KeyEntry struct {
+	// 32位小写十六进制KID，或mp4decrypt使用的十进制轨道ID
+	KID string `json:"kid"`
+	// 32位小写十六进制密钥
+	Key string `json:"key"`
+	// 可选的内容ID，用于限定密钥适用的内容
+	ContentID string `json:"content_id,omitempty"`
+	// 可选的备注
+	Label string `json:"label,omitempty"`
+}
+
+// String 返回解密引擎使用的 KID:KEY 格式
+func (e *KeyEntry) String() string {
+	return e.KID + ":" + e.Key
+}
+
+// KeyStore 按KID索引的密钥库，文件只在创建时读取一次
+type KeyStore struct {
+	path    string
+	format  string
+	mu      sync.RWMutex
+	entries []*KeyEntry
+	byKID   map[string][]*KeyEntry
+}
+
+// NewKeyStore 创建空的密钥库，格式由文件扩展名决定
+func NewKeyStore(path string) *KeyStore {
+	return &KeyStore{
+		path:   path,
+		format: keyStoreFormat(path),
+		byKID:  make(map[string][]*KeyEntry),
+	}
+}
+
+// LoadKeyStore 读取密钥库文件，支持 KID:KEY 文本、JSON 和 CSV 格式
+func LoadKeyStore(path string) (*KeyStore, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开密钥文件失败: %w", err)
+	}
+	defer file.Close()
+
+	store := NewKeyStore(path)
+	var entries []*KeyEntry
+	switch store.format {
+	case KeyStoreFormatJSON:
+		entries, err = parseJSONKeys(file)
+	case KeyStoreFormatCSV:
+		entries, err = parseCSVKeys(file)
+	default:
+		entries, err = parseTextKeys(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析密钥文件 %s 失败: %w", path, err)
+	}
+	for _, entry := range entries {
+		store.add(entry)
+	}
+	return store, nil
+}
+
+// ParseKeyPair 解析并校验 KID:KEY 或 mp4decrypt的 TRACK_ID:KEY 格式的密钥
+func ParseKeyPair(pair string) (*KeyEntry, error) {
+	pair = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(pair), "--key"))
+	parts := strings.SplitN(pair, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("密钥格式应为 KID:KEY 或 TRACK_ID:KEY: %s", pair)
+	}
+	return newKeyEntry(parts[0], parts[1], "", "")
+}
+
+// ParseTrackID 解析mp4decrypt密钥中的十进制轨道ID
+func ParseTrackID(value string) (uint32, bool) {
+	id, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint32(id), true
+}
+
+// newKeyEntry 校验KID（或轨道ID）和密钥，密钥须为16字节的十六进制
+func newKeyEntry(kid, key, contentID, label string) (*KeyEntry, error) {
+	normalizedKID := NormalizeKID(kid)
+	if trackID, ok := ParseTrackID(kid); ok && normalizedKID == "" {
+		normalizedKID = strconv.FormatUint(uint64(trackID), 10)
+	}
+	if normalizedKID == "" {
+		return nil, fmt.Errorf("KID无效，应为32位十六进制或十进制轨道ID: %s", strings.TrimSpace(kid))
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+	if len(key) != 32 {
+		return nil, fmt.Errorf("KID %s 的密钥长度无效，应为32位十六进制，实际%d位", normalizedKID, len(key))
+	}
+	if _, err := hex.DecodeString(key); err != nil {
+		return nil, fmt.Errorf("KID %s 的密钥不是有效的十六进制: %s", normalizedKID, key)
+	}
+	return &KeyEntry{
+		KID:       normalizedKID,
+		Key:       key,
+		ContentID: strings.TrimSpace(contentID),
+		Label:     strings.TrimSpace(label),
+	}, nil
+}
+
+// Lookup 按KID查找密钥。指定contentID时优先匹配相同内容ID的记录，
+// 其次是未限定内容ID的记录，属于其他内容的记录不会匹配
+func (s *KeyStore) Lookup(kid, contentID string) (*KeyEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	candidates := s.byKID[NormalizeKID(kid)]
+	if contentID == "" {
+		if len(candidates) > 0 {
+			return candidates[0], true
+		}
+		return nil, false
+	}
+	var unscoped *KeyEntry
+	for _, entry := range candidates {
+		if entry.ContentID == contentID {
+			return entry, true
+		}
+		if entry.ContentID == "" && unscoped == nil {
+			unscoped = entry
+		}
+	}
+	return unscoped, unscoped != nil
+}
+
+// Entries 返回全部记录
+func (s *KeyStore) Entries() []*KeyEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*KeyEntry(nil), s.entries...)
+}
+
+// Append 将库中尚不存在的密钥加入并写回文件，返回新增的数量
+func (s *KeyStore) Append(entries []*KeyEntry) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var added []*KeyEntry
+	for _, entry := range entries {
+		if s.contains(entry) {
+			continue
+		}
+		s.add(entry)
+		added = append(added, entry)
+	}
+	if len(added) == 0 {
+		return 0, nil
+	}
+	if err := s.persist(added); err != nil {
+		return 0, err
+	}
+	return len(added), nil
+}
+
+func (s *KeyStore) add(entry *KeyEntry) {
+	s.entries = append(s.entries, entry)
+	s.byKID[entry.KID] = append(s.byKID[entry.KID], entry)
+}
+
+func (s *KeyStore) contains(entry *KeyEntry) bool {
+	for _, existing := range s.byKID[entry.KID] {
+		if existing.Key == entry.Key && existing.ContentID == entry.ContentID {
+			return true
+		}
+	}
+	return false
+}
+
+// persist 文本和CSV格式追加到文件末尾，JSON格式整体重写
+func (s *KeyStore) persist(added []*KeyEntry) error {
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建密钥文件目录失败: %w", err)
+		}
+	}
+
+	if s.format == KeyStoreFormatJSON {
+		data, err := json.MarshalIndent(s.entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("序列化密钥失败: %w", err)
+		}
+		tmpPath := s.path + ".tmp"
+		if err := os.WriteFile(tmpPath, append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("写入密钥文件失败: %w", err)
+		}
+		if err := os.Rename(tmpPath, s.path); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("写入密钥文件失败: %w", err)
+		}
+		return nil
+	}
+
+	info, statErr := os.Stat(s.path)
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("打开密钥文件失败: %w", err)
+	}
+	defer file.Close()
+
+	if s.format == KeyStoreFormatCSV {
+		writer := csv.NewWriter(file)
+		if statErr != nil || info.Size() == 0 {
+			writer.Write([]string{"kid", "key", "content_id", "label"})
+		}
+		for _, entry := range added {
+			writer.Write([]string{entry.KID, entry.Key, entry.ContentID, entry.Label})
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("写入密钥文件失败: %w", err)
+		}
+		return nil
+	}
+
+	var builder strings.Builder
+	if statErr == nil && info.Size() > 0 && !endsWithNewline(s.path, info.Size()) {
+		builder.WriteString("\n")
+	}
+	for _, entry := range added {
+		builder.WriteString(entry.String() + "\n")
+	}
+	if _, err := file.WriteString(builder.String()); err != nil {
+		return fmt.Errorf("写入密钥文件失败: %w", err)
+	}
+	return nil
+}
+
+// endsWithNewline 判断文件是否以换行结尾，避免追加的记录与最后一行相连
+func endsWithNewline(path string, size int64) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, size-1); err != nil {
+		return true
+	}
+	return last[0] == '\n'
+}
+
+func keyStoreFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return KeyStoreFormatJSON
+	case ".csv":
+		return KeyStoreFormatCSV
+	default:
+		return KeyStoreFormatText
+	}
+}
+
+// parseTextKeys 解析每行一个 KID:KEY 的文本，忽略空行和#开头的注释，兼容 --key 前缀
+// 无效的行跳过并给出警告，不影响其他密钥
+func parseTextKeys(r io.Reader) ([]*KeyEntry, error) {
+	var entries []*KeyEntry
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, err := ParseKeyPair(line)
+		if err != nil {
+			Logger.Warn("密钥文件第%d行无效，已跳过: %v", lineNumber, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取失败: %w", err)
+	}
+	return entries, nil
+}
+
+// parseJSONKeys 支持记录数组、{"keys": [...]} 以及 {"KID": "KEY"} 三种写法
+func parseJSONKeys(r io.Reader) ([]*KeyEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("读取失败: %w", err)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return nil, nil
+	}
+
+	var records []KeyEntry
+	if err := json.Unmarshal(data, &records); err != nil {
+		var wrapper struct {
+			Keys []KeyEntry `json:"keys"`
+		}
+		var pairs map[string]string
+		if err := json.Unmarshal(data, &wrapper); err == nil && wrapper.Keys != nil {
+			records = wrapper.Keys
+		} else if err := json.Unmarshal(data, &pairs); err == nil {
+			for kid, key := range pairs {
+				records = append(records, KeyEntry{KID: kid, Key: key})
+			}
+		} else {
+			return nil, fmt.Errorf("JSON格式无效: %w", err)
+		}
+	}
+
+	entries := make([]*KeyEntry, 0, len(records))
+	for i, record := range records {
+		entry, err := newKeyEntry(record.KID, record.Key, record.ContentID, record.Label)
+		if err != nil {
+			Logger.Warn("密钥文件第%d条记录无效，已跳过: %v", i+1, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// isTrackIDField 判断CSV首列是否为轨道ID，用于区分表头行
+func isTrackIDField(value string) bool {
+	_, ok := ParseTrackID(value)
+	return ok
+}
+
+// parseCSVKeys 解析 kid,key[,content_id[,label]] 格式，首行为表头时按列名取值
+// 无效的行跳过并给出警告，不影响其他密钥
+func parseCSVKeys(r io.Reader) ([]*KeyEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	var rows [][]string
+	var lines []int
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, fmt.Errorf("读取失败: %w", err)
+			}
+			Logger.Warn("密钥文件第%d行无效，已跳过: %v", parseErr.Line, parseErr.Err)
+			continue
+		}
+		rows = append(rows, row)
+		lines = append(lines, line)
+	}
+
+	columns := map[string]int{"kid": 0, "key": 1, "content_id": 2, "label": 3}
+	start := 0
+	if len(rows) > 0 && len(rows[0]) > 0 && NormalizeKID(rows[0][0]) == "" && !isTrackIDField(rows[0][0]) {
+		// 表头行
+		columns = make(map[string]int)
+		for i, name := range rows[0] {
+			name = strings.ToLower(strings.TrimSpace(name))
+			name = strings.NewReplacer("-", "_", " ", "_").Replace(name)
+			if name == "contentid" {
+				name = "content_id"
+			}
+			columns[name] = i
+		}
+		if _, ok := columns["kid"]; !ok {
+			return nil, fmt.Errorf("CSV表头缺少kid列")
+		}
+		if _, ok := columns["key"]; !ok {
+			return nil, fmt.Errorf("CSV表头缺少key列")
+		}
+		start = 1
+	}
+
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	var entries []*KeyEntry
+	for i := start; i < len(rows); i++ {
+		row := rows[i]
+		if len(row) == 1 && strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		entry, err := newKeyEntry(field(row, "kid"), field(row, "key"), field(row, "content_id"), field(row, "label"))
+		if err != nil {
+			Logger.Warn("密钥文件第%d行无效，已跳过: %v", lines[i], err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
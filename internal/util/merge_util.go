@@ -299,7 +299,7 @@ type OutputFile struct {
 }
 
 // MuxInputsByFFmpeg 使用FFmpeg复用多个输入文件
-func MuxInputsByFFmpeg(ffmpegPath string, files []*OutputFile, outputPath string, muxFormat string, dateinfo bool, workingDir string) error {
+func MuxInputsByFFmpeg(ffmpegPath string, files []*OutputFile, outputPath string, muxFormat string, dateinfo bool, title string, workingDir string) error {
 	if len(files) == 0 {
 		return fmt.Errorf("没有文件需要复用")
 	}
@@ -401,6 +401,10 @@ func MuxInputsByFFmpeg(ffmpegPath string, files []*OutputFile, outputPath string
 		args = append(args, "-metadata", fmt.Sprintf("date=%s", dateString))
 	}
 
+	if title != "" {
+		args = append(args, "-metadata", fmt.Sprintf("title=%s", title))
+	}
+
 	args = append(args, "-ignore_unknown", "-copy_unknown")
 
 	// 设置输出文件扩展名
@@ -423,7 +427,7 @@ func MuxInputsByFFmpeg(ffmpegPath string, files []*OutputFile, outputPath string
 }
 
 // MuxInputsByMkvmerge 使用mkvmerge复用多个输入文件 - 重要修复：添加缺失的方法
-func MuxInputsByMkvmerge(mkvmergePath string, files []*OutputFile, outputPath string, workingDir string) error {
+func MuxInputsByMkvmerge(mkvmergePath string, files []*OutputFile, outputPath string, title string, workingDir string) error {
 	if len(files) == 0 {
 		return fmt.Errorf("没有文件需要复用")
 	}
@@ -435,6 +439,10 @@ func MuxInputsByMkvmerge(mkvmergePath string, files []*OutputFile, outputPath st
 	// 添加无章节参数 - 参考C#版本第256行
 	args = append(args, "--no-chapters")
 
+	if title != "" {
+		args = append(args, "--title", title)
+	}
+
 	dFlag := false // 用于音频默认轨道标记
 
 	// 添加语言和名称参数 - 参考C#版本第261-279行
@@ -0,0 +1,772 @@
+package util
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// piffSampleEncryptionUUID identifies the PIFF 1.1 sample encryption box used by Smooth Streaming.
+var piffSampleEncryptionUUID = []byte{0xa2, 0x39, 0x4f, 0x52, 0x5a, 0x9b, 0x4f, 0x14, 0xa2, 0x44, 0x6c, 0x42, 0x7c, 0x64, 0x8d, 0xf4}
+
+// cencTrack holds the protection defaults of a track, taken from its tenc and schm boxes.
+type cencTrack struct {
+	TrackID     uint32
+	Scheme      string
+	IsProtected bool
+	// IVSize is -1 when no tenc is available and the size has to be inferred.
+	IVSize     int
+	KID        []byte
+	ConstantIV []byte
+	// Pattern encryption (cens/cbcs) in 16-byte blocks.
+	CryptByteBlock    int
+	SkipByteBlock     int
+	DefaultSampleSize uint32
+
+	// Sample entry type and sinf box offsets, used to rewrite the sample entry to clear.
+	entryOffset    int64
+	sinfOffset     int64
+	originalFormat string
+}
+
+// cencSubsample is one clear/protected byte range pair of a sample.
+type cencSubsample struct {
+	ClearBytes     int
+	ProtectedBytes int
+}
+
+// cencSampleInfo is the per-sample auxiliary information (IV and subsample map).
+type cencSampleInfo struct {
+	IV         []byte
+	Subsamples []cencSubsample
+}
+
+// cencTrun is a parsed trun box.
+type cencTrun struct {
+	DataOffset  *int32
+	SampleSizes []uint32
+}
+
+// cencTraf collects the boxes of a track fragment needed for decryption.
+type cencTraf struct {
+	moofStart      int64
+	TrackID        uint32
+	BaseDataOffset *uint64
+	DefaultSize    uint32
+	Truns          []*cencTrun
+
+	sencPayload []byte
+	sencFlags   uint32
+	// PIFF can override the track defaults per fragment.
+	piffIVSize int
+	piffKID    []byte
+
+	saizDefault uint8
+	saizSizes   []uint8
+	saizCount   uint32
+	saioOffsets []uint64
+
+	// Offsets of boxes that are renamed to 'free' once the fragment is decrypted.
+	encryptionBoxes []int64
+}
+
+// CENCDecrypter decrypts fragmented MP4 data protected with the Common Encryption schemes
+// 'cenc' and 'cens' (AES-CTR) or 'cbc1' and 'cbcs' (AES-CBC).
+type CENCDecrypter struct {
+	keys map[string][]byte
+	// Keys given as mp4decrypt style TRACK_ID:KEY.
+	trackKeys map[uint32][]byte
+	tracks    map[uint32]*cencTrack
+}
+
+// NewCENCDecrypter creates a decrypter from KID:KEY or TRACK_ID:KEY pairs.
+func NewCENCDecrypter(keys []string) (*CENCDecrypter, error) {
+	d := &CENCDecrypter{
+		keys:      make(map[string][]byte),
+		trackKeys: make(map[uint32][]byte),
+		tracks:    make(map[uint32]*cencTrack),
+	}
+	for _, pair := range keys {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid key format: %s", pair)
+		}
+		key, err := hex.DecodeString(strings.TrimSpace(parts[1]))
+		if err != nil || len(key) != 16 {
+			return nil, fmt.Errorf("invalid key: %s", pair)
+		}
+		if kid := NormalizeKID(parts[0]); kid != "" {
+			d.keys[kid] = key
+		} else if trackID, ok := ParseTrackID(parts[0]); ok {
+			d.trackKeys[trackID] = key
+		} else {
+			return nil, fmt.Errorf("invalid key: %s", pair)
+		}
+	}
+	if len(d.keys) == 0 && len(d.trackKeys) == 0 {
+		return nil, fmt.Errorf("no keys provided")
+	}
+	return d, nil
+}
+
+// SetTracks replaces the track defaults, e.g. with those from an init segment.
+func (d *CENCDecrypter) SetTracks(tracks map[uint32]*cencTrack) {
+	for id, track := range tracks {
+		d.tracks[id] = track
+	}
+}
+
+// Decrypt decrypts an init segment, a media segment or a complete fragmented MP4 in place.
+// fallbackKID is used when the data does not carry the KID itself.
+// Protection boxes are renamed to 'free' instead of being removed so that trun data offsets stay valid.
+func (d *CENCDecrypter) Decrypt(data []byte, fallbackKID string) error {
+	tracks, trafs, err := parseCENCBoxes(data)
+	if err != nil {
+		return err
+	}
+	d.SetTracks(tracks)
+
+	// Rewrite encrypted sample entries once their key is known.
+	for _, track := range tracks {
+		if track.entryOffset == 0 || track.originalFormat == "" {
+			continue
+		}
+		if _, err := d.keyFor(track.TrackID, track.KID, fallbackKID); err != nil {
+			return err
+		}
+		copy(data[track.entryOffset+4:track.entryOffset+8], track.originalFormat)
+		if track.sinfOffset > 0 {
+			copy(data[track.sinfOffset+4:track.sinfOffset+8], "free")
+		}
+	}
+
+	for _, traf := range trafs {
+		if err := d.decryptTraf(data, traf, fallbackKID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *CENCDecrypter) keyFor(trackID uint32, kid []byte, fallbackKID string) ([]byte, error) {
+	if key, ok := d.trackKeys[trackID]; ok {
+		return key, nil
+	}
+	if len(kid) == 16 && !bytes.Equal(kid, make([]byte, 16)) {
+		if key, ok := d.keys[hex.EncodeToString(kid)]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("no key for KID %x", kid)
+	}
+	if key, ok := d.keys[NormalizeKID(fallbackKID)]; ok {
+		return key, nil
+	}
+	if len(d.keys) == 1 {
+		for _, key := range d.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("KID unknown and no matching key")
+}
+
+func (d *CENCDecrypter) decryptTraf(data []byte, traf *cencTraf, fallbackKID string) error {
+	track := d.tracks[traf.TrackID]
+	if track == nil {
+		track = &cencTrack{TrackID: traf.TrackID, Scheme: "cenc", IsProtected: true, IVSize: -1}
+	}
+	switch track.Scheme {
+	case "cenc", "piff", "cens", "cbc1", "cbcs":
+	default:
+		return fmt.Errorf("unsupported protection scheme: %s", track.Scheme)
+	}
+	if !track.IsProtected {
+		// tenc marks the samples as unencrypted (e.g. clear lead), any senc entries carry no IVs.
+		return nil
+	}
+
+	kid := track.KID
+	if len(traf.piffKID) == 16 {
+		kid = traf.piffKID
+	}
+	ivSize := track.IVSize
+	if traf.piffIVSize > 0 {
+		ivSize = traf.piffIVSize
+	}
+
+	samples, err := traf.samplePositions(track)
+	if err != nil {
+		return err
+	}
+	infos, err := traf.sampleInfos(data, ivSize, len(samples))
+	if err != nil {
+		return err
+	}
+	if infos == nil && track.IsProtected && len(track.ConstantIV) > 0 {
+		// Without auxiliary information every sample is fully protected with the constant IV.
+		for range samples {
+			infos = append(infos, &cencSampleInfo{})
+		}
+	}
+	if infos == nil {
+		if track.IsProtected && (len(traf.sencPayload) > 0 || traf.saizCount > 0) {
+			return fmt.Errorf("failed to read sample encryption info for track %d", traf.TrackID)
+		}
+		return nil // clear fragment
+	}
+	if len(infos) != len(samples) {
+		return fmt.Errorf("sample count mismatch: %d samples, %d encryption entries", len(samples), len(infos))
+	}
+
+	key, err := d.keyFor(traf.TrackID, kid, fallbackKID)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	for i, sample := range samples {
+		if sample[1] > int64(len(data)) {
+			return fmt.Errorf("sample %d exceeds data bounds", i)
+		}
+		if err := decryptSample(track, block, infos[i], data[sample[0]:sample[1]]); err != nil {
+			return fmt.Errorf("sample %d: %w", i, err)
+		}
+	}
+
+	for _, offset := range traf.encryptionBoxes {
+		copy(data[offset+4:offset+8], "free")
+	}
+	return nil
+}
+
+// decryptSample decrypts one sample in place according to the protection scheme.
+func decryptSample(track *cencTrack, block cipher.Block, info *cencSampleInfo, sample []byte) error {
+	ivBytes := info.IV
+	if len(ivBytes) == 0 {
+		ivBytes = track.ConstantIV
+	}
+	if len(ivBytes) == 0 {
+		return fmt.Errorf("no IV: sample has no per-sample IV and track %d has no constant IV", track.TrackID)
+	}
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, ivBytes)
+
+	ranges, err := protectedRanges(info, len(sample))
+	if err != nil {
+		return err
+	}
+
+	switch track.Scheme {
+	case "cens":
+		// The keystream only advances over encrypted blocks and continues across subsamples.
+		stream := cipher.NewCTR(block, iv)
+		for _, r := range ranges {
+			decryptPattern(sample[r[0]:r[1]], track.CryptByteBlock, track.SkipByteBlock, func(b []byte) {
+				stream.XORKeyStream(b, b)
+			})
+		}
+	case "cbcs":
+		// The CBC chain restarts with the sample IV for every subsample.
+		for _, r := range ranges {
+			mode := cipher.NewCBCDecrypter(block, iv)
+			decryptPattern(sample[r[0]:r[1]], track.CryptByteBlock, track.SkipByteBlock, func(b []byte) {
+				mode.CryptBlocks(b, b)
+			})
+		}
+	case "cbc1":
+		// One CBC chain over the whole blocks of all subsamples.
+		mode := cipher.NewCBCDecrypter(block, iv)
+		for _, r := range ranges {
+			decryptPattern(sample[r[0]:r[1]], 0, 0, func(b []byte) {
+				mode.CryptBlocks(b, b)
+			})
+		}
+	default:
+		// cenc: the keystream runs continuously across protected subsample ranges, including partial blocks.
+		stream := cipher.NewCTR(block, iv)
+		for _, r := range ranges {
+			stream.XORKeyStream(sample[r[0]:r[1]], sample[r[0]:r[1]])
+		}
+	}
+	return nil
+}
+
+// protectedRanges returns the [start, end) ranges of the protected bytes of a sample.
+func protectedRanges(info *cencSampleInfo, sampleSize int) ([][2]int, error) {
+	if len(info.Subsamples) == 0 {
+		return [][2]int{{0, sampleSize}}, nil
+	}
+	var ranges [][2]int
+	pos := 0
+	for _, sub := range info.Subsamples {
+		pos += sub.ClearBytes
+		end := pos + sub.ProtectedBytes
+		if end > sampleSize {
+			return nil, fmt.Errorf("subsample map exceeds sample size")
+		}
+		if end > pos {
+			ranges = append(ranges, [2]int{pos, end})
+		}
+		pos = end
+	}
+	return ranges, nil
+}
+
+// decryptPattern applies crypt to the encrypted 16-byte blocks of a protected range.
+// A 0:0 pattern means every whole block is encrypted; a trailing partial block is always left clear.
+func decryptPattern(data []byte, cryptBlocks, skipBlocks int, crypt func([]byte)) {
+	wholeBlocks := len(data) / aes.BlockSize * aes.BlockSize
+	if cryptBlocks == 0 && skipBlocks == 0 {
+		if wholeBlocks > 0 {
+			crypt(data[:wholeBlocks])
+		}
+		return
+	}
+	for pos := 0; pos < wholeBlocks; pos += (cryptBlocks + skipBlocks) * aes.BlockSize {
+		end := pos + cryptBlocks*aes.BlockSize
+		if end > wholeBlocks {
+			end = wholeBlocks
+		}
+		if end > pos {
+			crypt(data[pos:end])
+		}
+	}
+}
+
+// samplePositions returns the [start, end) byte range of every sample in the fragment.
+func (t *cencTraf) samplePositions(track *cencTrack) ([][2]int64, error) {
+	base := t.moofStart
+	if t.BaseDataOffset != nil {
+		base = int64(*t.BaseDataOffset)
+	}
+
+	var positions [][2]int64
+	pos := base
+	for _, trun := range t.Truns {
+		if trun.DataOffset != nil {
+			pos = base + int64(*trun.DataOffset)
+		}
+		for _, size := range trun.SampleSizes {
+			if size == 0 {
+				size = t.DefaultSize
+			}
+			if size == 0 {
+				size = track.DefaultSampleSize
+			}
+			if size == 0 {
+				return nil, fmt.Errorf("sample size unknown for track %d", t.TrackID)
+			}
+			positions = append(positions, [2]int64{pos, pos + int64(size)})
+			pos += int64(size)
+		}
+	}
+	return positions, nil
+}
+
+// sampleInfos reads the per-sample IVs and subsample maps from senc/PIFF or saiz/saio.
+func (t *cencTraf) sampleInfos(data []byte, ivSize, sampleCount int) ([]*cencSampleInfo, error) {
+	if len(t.sencPayload) >= 4 {
+		count := int(binary.BigEndian.Uint32(t.sencPayload[0:4]))
+		hasSubsamples := t.sencFlags&0x2 != 0
+		entries := t.sencPayload[4:]
+		if ivSize < 0 {
+			ivSize = inferIVSize(entries, count, hasSubsamples)
+		}
+		return parseSampleEncryptionEntries(entries, count, ivSize, hasSubsamples)
+	}
+
+	if t.saizCount == 0 || len(t.saioOffsets) == 0 {
+		return nil, nil
+	}
+	base := t.moofStart
+	if t.BaseDataOffset != nil {
+		base = int64(*t.BaseDataOffset)
+	}
+	pos := base + int64(t.saioOffsets[0])
+
+	sizes := make([]int, t.saizCount)
+	total := 0
+	for i := range sizes {
+		sizes[i] = int(t.saizDefault)
+		if t.saizDefault == 0 && i < len(t.saizSizes) {
+			sizes[i] = int(t.saizSizes[i])
+		}
+		total += sizes[i]
+	}
+	if pos < 0 || pos+int64(total) > int64(len(data)) {
+		return nil, fmt.Errorf("saio offset out of range")
+	}
+
+	var infos []*cencSampleInfo
+	for _, size := range sizes {
+		entry := data[pos : pos+int64(size)]
+		pos += int64(size)
+		sampleIVSize := ivSize
+		hasSubsamples := size > sampleIVSize
+		if sampleIVSize < 0 {
+			sampleIVSize = inferIVSize(entry, 1, size > 16)
+			hasSubsamples = size > sampleIVSize
+		}
+		parsed, err := parseSampleEncryptionEntries(entry, 1, sampleIVSize, hasSubsamples)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, parsed...)
+	}
+	return infos, nil
+}
+
+// inferIVSize guesses the per-sample IV size when no tenc is available.
+func inferIVSize(entries []byte, count int, hasSubsamples bool) int {
+	if count == 0 {
+		return 8
+	}
+	if !hasSubsamples {
+		if size := len(entries) / count; size == 8 || size == 16 {
+			return size
+		}
+		return 8
+	}
+	for _, size := range []int{8, 16} {
+		if _, err := parseSampleEncryptionEntries(entries, count, size, true); err == nil {
+			return size
+		}
+	}
+	return 8
+}
+
+// parseSampleEncryptionEntries parses senc-style entries; the data must be consumed exactly.
+func parseSampleEncryptionEntries(entries []byte, count, ivSize int, hasSubsamples bool) ([]*cencSampleInfo, error) {
+	r := bytes.NewReader(entries)
+	infos := make([]*cencSampleInfo, 0, count)
+	for i := 0; i < count; i++ {
+		if r.Len() < ivSize {
+			return nil, fmt.Errorf("sample encryption entry %d truncated", i)
+		}
+		info := &cencSampleInfo{IV: readBytes(r, ivSize)}
+		if hasSubsamples {
+			if r.Len() < 2 {
+				return nil, fmt.Errorf("subsample count %d truncated", i)
+			}
+			n := int(binary.BigEndian.Uint16(readBytes(r, 2)))
+			if r.Len() < n*6 {
+				return nil, fmt.Errorf("subsample map %d truncated", i)
+			}
+			for j := 0; j < n; j++ {
+				clear := int(binary.BigEndian.Uint16(readBytes(r, 2)))
+				protected := int(binary.BigEndian.Uint32(readBytes(r, 4)))
+				info.Subsamples = append(info.Subsamples, cencSubsample{ClearBytes: clear, ProtectedBytes: protected})
+			}
+		}
+		infos = append(infos, info)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes in sample encryption data", r.Len())
+	}
+	return infos, nil
+}
+
+// parseCENCBoxes collects track protection defaults from moov and fragment encryption data from every moof.
+func parseCENCBoxes(data []byte) (map[uint32]*cencTrack, []*cencTraf, error) {
+	tracks := make(map[uint32]*cencTrack)
+	var trafs []*cencTraf
+	var track *cencTrack
+	var traf *cencTraf
+	var moofStart int64
+	// parseErr records the first truncated box, since box handlers cannot return errors.
+	var parseErr error
+
+	sampleEntry := func(skip int) func(*Box) {
+		return func(b *Box) {
+			if track != nil {
+				track.entryOffset = int64(b.AbsStart())
+			}
+			if b.Reader.Len() < skip {
+				return
+			}
+			b.Reader.Seek(int64(skip), 1)
+			for b.Reader.Len() > 0 {
+				if err := b.parser.parseNext(b.Reader, b.absStart+b.headerSize); err != nil {
+					break
+				}
+			}
+		}
+	}
+
+	parser := NewMP4Parser().
+		Box("moov", Children).
+		Box("trak", func(b *Box) {
+			track = &cencTrack{Scheme: "cenc", IsProtected: true, IVSize: -1}
+			Children(b)
+			if track.TrackID != 0 && (track.originalFormat != "" || len(track.KID) > 0) {
+				tracks[track.TrackID] = track
+			}
+			track = nil
+		}).
+		FullBox("tkhd", func(b *Box) {
+			if track == nil {
+				return
+			}
+			if *b.Version == 1 {
+				b.Reader.Seek(16, 1)
+			} else {
+				b.Reader.Seek(8, 1)
+			}
+			if b.Reader.Len() >= 4 {
+				track.TrackID = binary.BigEndian.Uint32(readBytes(b.Reader, 4))
+			}
+		}).
+		Box("mdia", Children).
+		Box("minf", Children).
+		Box("stbl", Children).
+		Box("stsd", SampleDescription).
+		Box("encv", sampleEntry(78)).
+		Box("enca", sampleEntry(28)).
+		Box("sinf", func(b *Box) {
+			if track != nil {
+				track.sinfOffset = int64(b.AbsStart())
+			}
+			Children(b)
+		}).
+		Box("frma", func(b *Box) {
+			if track != nil && b.Reader.Len() >= 4 {
+				track.originalFormat = string(readBytes(b.Reader, 4))
+			}
+		}).
+		FullBox("schm", func(b *Box) {
+			if track != nil && b.Reader.Len() >= 4 {
+				track.Scheme = string(readBytes(b.Reader, 4))
+			}
+		}).
+		Box("schi", Children).
+		FullBox("tenc", func(b *Box) {
+			if track == nil || b.Reader.Len() < 20 {
+				return
+			}
+			payload := readBytes(b.Reader, 20)
+			if *b.Version > 0 {
+				track.CryptByteBlock = int(payload[1] >> 4)
+				track.SkipByteBlock = int(payload[1] & 0x0F)
+			}
+			track.IsProtected = payload[2] != 0
+			track.IVSize = int(payload[3])
+			track.KID = payload[4:20]
+			if track.IsProtected && track.IVSize == 0 && b.Reader.Len() >= 1 {
+				size := int(readBytes(b.Reader, 1)[0])
+				if b.Reader.Len() >= size {
+					track.ConstantIV = readBytes(b.Reader, size)
+				}
+			}
+		}).
+		Box("mvex", Children).
+		FullBox("trex", func(b *Box) {
+			if b.Reader.Len() < 20 {
+				return
+			}
+			payload := readBytes(b.Reader, 20)
+			trackID := binary.BigEndian.Uint32(payload[0:4])
+			if t, ok := tracks[trackID]; ok {
+				t.DefaultSampleSize = binary.BigEndian.Uint32(payload[12:16])
+			}
+		}).
+		Box("moof", func(b *Box) {
+			moofStart = int64(b.AbsStart())
+			Children(b)
+		}).
+		Box("traf", func(b *Box) {
+			traf = &cencTraf{moofStart: moofStart}
+			Children(b)
+			trafs = append(trafs, traf)
+			traf = nil
+		}).
+		FullBox("tfhd", func(b *Box) {
+			if traf == nil || b.Reader.Len() < 4 {
+				return
+			}
+			flags := *b.Flags
+			traf.TrackID = binary.BigEndian.Uint32(readBytes(b.Reader, 4))
+			if flags&0x01 != 0 && b.Reader.Len() >= 8 {
+				offset := binary.BigEndian.Uint64(readBytes(b.Reader, 8))
+				traf.BaseDataOffset = &offset
+			}
+			if flags&0x02 != 0 {
+				b.Reader.Seek(4, 1)
+			}
+			if flags&0x08 != 0 {
+				b.Reader.Seek(4, 1)
+			}
+			if flags&0x10 != 0 && b.Reader.Len() >= 4 {
+				traf.DefaultSize = binary.BigEndian.Uint32(readBytes(b.Reader, 4))
+			}
+		}).
+		FullBox("trun", func(b *Box) {
+			if traf == nil || b.Reader.Len() < 4 {
+				return
+			}
+			flags := *b.Flags
+			trun := &cencTrun{}
+			count := binary.BigEndian.Uint32(readBytes(b.Reader, 4))
+			if flags&0x01 != 0 {
+				offset := int32(binary.BigEndian.Uint32(readBytes(b.Reader, 4)))
+				trun.DataOffset = &offset
+			}
+			if flags&0x04 != 0 {
+				b.Reader.Seek(4, 1)
+			}
+			entrySize := 0
+			for _, flag := range []uint32{0x100, 0x200, 0x400, 0x800} {
+				if flags&flag != 0 {
+					entrySize += 4
+				}
+			}
+			if uint64(count)*uint64(entrySize) > uint64(b.Reader.Len()) {
+				if parseErr == nil {
+					parseErr = fmt.Errorf("truncated trun in track %d: %d samples need %d bytes, %d left",
+						traf.TrackID, count, uint64(count)*uint64(entrySize), b.Reader.Len())
+				}
+				return
+			}
+			// Samples without per-sample sizes still count; their size comes from the defaults.
+			for i := uint32(0); i < count; i++ {
+				if flags&0x100 != 0 {
+					b.Reader.Seek(4, 1)
+				}
+				var size uint32
+				if flags&0x200 != 0 {
+					size = binary.BigEndian.Uint32(readBytes(b.Reader, 4))
+				}
+				if flags&0x400 != 0 {
+					b.Reader.Seek(4, 1)
+				}
+				if flags&0x800 != 0 {
+					b.Reader.Seek(4, 1)
+				}
+				trun.SampleSizes = append(trun.SampleSizes, size)
+			}
+			traf.Truns = append(traf.Truns, trun)
+		}).
+		FullBox("senc", func(b *Box) {
+			if traf == nil {
+				return
+			}
+			traf.sencFlags = *b.Flags
+			traf.sencPayload = readBytes(b.Reader, b.Reader.Len())
+			traf.encryptionBoxes = append(traf.encryptionBoxes, int64(b.AbsStart()))
+		}).
+		Box("uuid", func(b *Box) {
+			if traf == nil || b.Reader.Len() < 20 || !bytes.Equal(readBytes(b.Reader, 16), piffSampleEncryptionUUID) {
+				return
+			}
+			flags := binary.BigEndian.Uint32(readBytes(b.Reader, 4)) & 0xFFFFFF
+			if flags&0x1 != 0 && b.Reader.Len() >= 20 {
+				override := readBytes(b.Reader, 20)
+				traf.piffIVSize = int(override[3])
+				traf.piffKID = override[4:20]
+			}
+			if len(traf.sencPayload) == 0 {
+				traf.sencFlags = flags
+				traf.sencPayload = readBytes(b.Reader, b.Reader.Len())
+			}
+			traf.encryptionBoxes = append(traf.encryptionBoxes, int64(b.AbsStart()))
+		}).
+		FullBox("saiz", func(b *Box) {
+			if traf == nil {
+				return
+			}
+			if *b.Flags&0x1 != 0 {
+				b.Reader.Seek(8, 1)
+			}
+			if b.Reader.Len() < 5 {
+				return
+			}
+			traf.saizDefault = readBytes(b.Reader, 1)[0]
+			traf.saizCount = binary.BigEndian.Uint32(readBytes(b.Reader, 4))
+			if traf.saizDefault == 0 {
+				traf.saizSizes = readBytes(b.Reader, b.Reader.Len())
+			}
+			traf.encryptionBoxes = append(traf.encryptionBoxes, int64(b.AbsStart()))
+		}).
+		FullBox("saio", func(b *Box) {
+			if traf == nil {
+				return
+			}
+			if *b.Flags&0x1 != 0 {
+				b.Reader.Seek(8, 1)
+			}
+			if b.Reader.Len() < 4 {
+				return
+			}
+			count := binary.BigEndian.Uint32(readBytes(b.Reader, 4))
+			entrySize := uint64(4)
+			if *b.Version == 1 {
+				entrySize = 8
+			}
+			if uint64(count)*entrySize > uint64(b.Reader.Len()) {
+				if parseErr == nil {
+					parseErr = fmt.Errorf("truncated saio in track %d", traf.TrackID)
+				}
+				return
+			}
+			for i := uint32(0); i < count; i++ {
+				if *b.Version == 1 {
+					traf.saioOffsets = append(traf.saioOffsets, binary.BigEndian.Uint64(readBytes(b.Reader, 8)))
+				} else {
+					traf.saioOffsets = append(traf.saioOffsets, uint64(binary.BigEndian.Uint32(readBytes(b.Reader, 4))))
+				}
+			}
+			traf.encryptionBoxes = append(traf.encryptionBoxes, int64(b.AbsStart()))
+		})
+
+	if err := parser.Parse(data); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse mp4: %w", err)
+	}
+	if parseErr != nil {
+		return nil, nil, parseErr
+	}
+	return tracks, trafs, nil
+}
+
+// NativeDecryptState keeps the track defaults of a decrypted init segment, so that
+// media segments of the same stream can be decrypted on their own. Use one state per stream.
+type NativeDecryptState struct {
+	mu     sync.Mutex
+	tracks map[uint32]*cencTrack
+}
+
+// DecryptMP4Native decrypts a CENC protected fragmented MP4 file in process.
+// state may be nil when the file carries its own init segment.
+func DecryptMP4Native(keys []string, encFile, decFile, kid string, state *NativeDecryptState) error {
+	decrypter, err := NewCENCDecrypter(keys)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(encFile)
+	if err != nil {
+		return err
+	}
+
+	if state != nil {
+		state.mu.Lock()
+		decrypter.SetTracks(state.tracks)
+		state.mu.Unlock()
+	}
+	if err := decrypter.Decrypt(data, kid); err != nil {
+		return err
+	}
+	if state != nil && len(decrypter.tracks) > 0 {
+		state.mu.Lock()
+		state.tracks = decrypter.tracks
+		state.mu.Unlock()
+	}
+
+	return os.WriteFile(decFile, data, 0644)
+}
@@ -0,0 +1,454 @@
+package util
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	testKID  = mustHex("0102030405060708090a0b0c0d0e0f10")
+	testKey  = mustHex("00112233445566778899aabbccddeeff")
+	testKID2 = mustHex("a0a1a2a3a4a5a6a7a8a9aaabacadaeaf")
+	testKey2 = mustHex("ffeeddccbbaa99887766554433221100")
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func be32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func be16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func testBox(name string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+	out := be32(uint32(size))
+	out = append(out, name...)
+	for _, p := range payloads {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func testFullBox(name string, version uint8, flags uint32, payloads ...[]byte) []byte {
+	return testBox(name, append([][]byte{be32(uint32(version)<<24 | flags)}, payloads...)...)
+}
+
+// testTenc builds a tenc box; version 1 carries the crypt:skip pattern, an IV size of 0 the constant IV.
+func testTenc(version uint8, cryptBlocks, skipBlocks, ivSize int, kid, constantIV []byte) []byte {
+	payload := []byte{0, 0, 1, byte(ivSize)}
+	if version > 0 {
+		payload[1] = byte(cryptBlocks<<4 | skipBlocks)
+	}
+	payload = append(payload, kid...)
+	if ivSize == 0 {
+		payload = append(payload, byte(len(constantIV)))
+		payload = append(payload, constantIV...)
+	}
+	return testFullBox("tenc", version, 0, payload)
+}
+
+// testInit builds a moov with one encv track protected by the given scheme.
+func testInit(trackID uint32, scheme string, tenc []byte) []byte {
+	tkhd := testFullBox("tkhd", 0, 0, make([]byte, 8), be32(trackID), make([]byte, 68))
+	sinf := testBox("sinf",
+		testBox("frma", []byte("avc1")),
+		testFullBox("schm", 0, 0, []byte(scheme), be32(0x00010000)),
+		testBox("schi", tenc))
+	encv := testBox("encv", make([]byte, 78), sinf)
+	stsd := testFullBox("stsd", 0, 0, be32(1), encv)
+	return testBox("moov", testBox("trak", tkhd, testBox("mdia", testBox("minf", testBox("stbl", stsd)))))
+}
+
+// testFragment builds a moof/mdat pair for one track whose trun points at the samples in mdat.
+// aux is appended to mdat after the samples; trafBoxes receives its offset from the start of the moof.
+func testFragment(trackID uint32, samples [][]byte, aux []byte, trafBoxes func(auxOffset uint32) [][]byte) []byte {
+	var sampleData []byte
+	sizes := [][]byte{be32(uint32(len(samples)))}
+	for _, sample := range samples {
+		sampleData = append(sampleData, sample...)
+		sizes = append(sizes, be32(uint32(len(sample))))
+	}
+
+	build := func(dataOffset, auxOffset uint32) []byte {
+		tfhd := testFullBox("tfhd", 0, 0x020000, be32(trackID))
+		trun := testFullBox("trun", 0, 0x000201, append([][]byte{sizes[0], be32(dataOffset)}, sizes[1:]...)...)
+		traf := append([][]byte{tfhd, trun}, trafBoxes(auxOffset)...)
+		return testBox("moof", testFullBox("mfhd", 0, 0, be32(1)), testBox("traf", traf...))
+	}
+	dataOffset := uint32(len(build(0, 0)) + 8)
+	moof := build(dataOffset, dataOffset+uint32(len(sampleData)))
+	return append(moof, testBox("mdat", sampleData, aux)...)
+}
+
+// testAuxEntry builds one sample encryption entry as stored in senc or referenced by saio.
+func testAuxEntry(iv []byte, subsamples []cencSubsample) []byte {
+	entry := append([]byte{}, iv...)
+	if len(subsamples) == 0 {
+		return entry
+	}
+	entry = append(entry, be16(uint16(len(subsamples)))...)
+	for _, sub := range subsamples {
+		entry = append(entry, be16(uint16(sub.ClearBytes))...)
+		entry = append(entry, be32(uint32(sub.ProtectedBytes))...)
+	}
+	return entry
+}
+
+// testMdat returns the payload of the last top-level mdat box.
+func testMdat(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var payload []byte
+	for pos := 0; pos+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		if size < 8 || pos+size > len(data) {
+			t.Fatalf("invalid box size %d at %d", size, pos)
+		}
+		if string(data[pos+4:pos+8]) == "mdat" {
+			payload = data[pos+8 : pos+size]
+		}
+		pos += size
+	}
+	if payload == nil {
+		t.Fatal("no mdat box")
+	}
+	return payload
+}
+
+// testPlainSample returns a deterministic clear sample.
+func testPlainSample(size, seed int) []byte {
+	sample := make([]byte, size)
+	for i := range sample {
+		sample[i] = byte(i*7 + seed)
+	}
+	return sample
+}
+
+// encryptTestSample encrypts a sample following the scheme definitions of ISO/IEC 23001-7.
+func encryptTestSample(t *testing.T, key []byte, scheme string, iv []byte, cryptBlocks, skipBlocks int, subsamples []cencSubsample, sample []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := append([]byte{}, sample...)
+	iv16 := make([]byte, aes.BlockSize)
+	copy(iv16, iv)
+
+	ranges := [][]byte{out}
+	if len(subsamples) > 0 {
+		ranges = nil
+		pos := 0
+		for _, sub := range subsamples {
+			pos += sub.ClearBytes
+			ranges = append(ranges, out[pos:pos+sub.ProtectedBytes])
+			pos += sub.ProtectedBytes
+		}
+	}
+
+	ctr := cipher.NewCTR(block, iv16)
+	cbc := cipher.NewCBCEncrypter(block, iv16)
+	for _, r := range ranges {
+		switch scheme {
+		case "cenc":
+			ctr.XORKeyStream(r, r)
+		case "cens":
+			for _, b := range testPatternBlocks(r, cryptBlocks, skipBlocks) {
+				ctr.XORKeyStream(b, b)
+			}
+		case "cbc1":
+			for _, b := range testPatternBlocks(r, 0, 0) {
+				cbc.CryptBlocks(b, b)
+			}
+		case "cbcs":
+			chain := cipher.NewCBCEncrypter(block, iv16)
+			for _, b := range testPatternBlocks(r, cryptBlocks, skipBlocks) {
+				chain.CryptBlocks(b, b)
+			}
+		default:
+			t.Fatalf("unknown scheme %s", scheme)
+		}
+	}
+	return out
+}
+
+// testPatternBlocks returns the whole 16-byte blocks of a range that a crypt:skip pattern encrypts.
+func testPatternBlocks(data []byte, cryptBlocks, skipBlocks int) [][]byte {
+	var blocks [][]byte
+	for i := 0; (i+1)*aes.BlockSize <= len(data); i++ {
+		if cryptBlocks+skipBlocks == 0 || i%(cryptBlocks+skipBlocks) < cryptBlocks {
+			blocks = append(blocks, data[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		}
+	}
+	return blocks
+}
+
+func TestCENCDecrypterSchemes(t *testing.T) {
+	tests := []struct {
+		name        string
+		scheme      string
+		tencVersion uint8
+		cryptBlocks int
+		skipBlocks  int
+		ivSize      int
+		constantIV  []byte
+		subsamples  []cencSubsample
+	}{
+		{
+			name:       "cenc subsamples with partial blocks",
+			scheme:     "cenc",
+			ivSize:     8,
+			subsamples: []cencSubsample{{ClearBytes: 5, ProtectedBytes: 37}, {ClearBytes: 3, ProtectedBytes: 20}},
+		},
+		{
+			name:   "cenc full sample",
+			scheme: "cenc",
+			ivSize: 16,
+		},
+		{
+			name:        "cens 1:2 pattern",
+			scheme:      "cens",
+			tencVersion: 1,
+			cryptBlocks: 1,
+			skipBlocks:  2,
+			ivSize:      16,
+			subsamples:  []cencSubsample{{ClearBytes: 7, ProtectedBytes: 100}, {ClearBytes: 2, ProtectedBytes: 64}},
+		},
+		{
+			name:       "cbc1 chain across subsamples",
+			scheme:     "cbc1",
+			ivSize:     16,
+			subsamples: []cencSubsample{{ClearBytes: 4, ProtectedBytes: 32}, {ClearBytes: 2, ProtectedBytes: 51}},
+		},
+		{
+			name:        "cbcs 1:9 pattern with constant IV",
+			scheme:      "cbcs",
+			tencVersion: 1,
+			cryptBlocks: 1,
+			skipBlocks:  9,
+			constantIV:  mustHex("000102030405060708090a0b0c0d0e0f"),
+			subsamples:  []cencSubsample{{ClearBytes: 10, ProtectedBytes: 180}, {ClearBytes: 5, ProtectedBytes: 40}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := [][]byte{testPlainSample(90, 3), testPlainSample(250, 11)}
+			if len(tt.subsamples) > 0 {
+				size := 0
+				for _, sub := range tt.subsamples {
+					size += sub.ClearBytes + sub.ProtectedBytes
+				}
+				// The second sample has a clear tail after the subsample map.
+				plain = [][]byte{testPlainSample(size, 3), testPlainSample(size+6, 11)}
+			}
+
+			var encrypted [][]byte
+			var entries [][]byte
+			for i, sample := range plain {
+				iv := bytes.Repeat([]byte{byte(i + 1)}, tt.ivSize)
+				sampleIV := iv
+				if tt.ivSize == 0 {
+					sampleIV = tt.constantIV
+				}
+				encrypted = append(encrypted, encryptTestSample(t, testKey, tt.scheme, sampleIV, tt.cryptBlocks, tt.skipBlocks, tt.subsamples, sample))
+				entries = append(entries, testAuxEntry(iv, tt.subsamples))
+			}
+
+			var sencFlags uint32
+			if len(tt.subsamples) > 0 {
+				sencFlags = 0x2
+			}
+			tenc := testTenc(tt.tencVersion, tt.cryptBlocks, tt.skipBlocks, tt.ivSize, testKID, tt.constantIV)
+			data := testInit(1, tt.scheme, tenc)
+			initSize := len(data)
+			data = append(data, testFragment(1, encrypted, nil, func(uint32) [][]byte {
+				return [][]byte{testFullBox("senc", 0, sencFlags, append([][]byte{be32(uint32(len(entries)))}, entries...)...)}
+			})...)
+
+			decrypter, err := NewCENCDecrypter([]string{hex.EncodeToString(testKID) + ":" + hex.EncodeToString(testKey)})
+			if err != nil {
+				t.Fatalf("NewCENCDecrypter: %v", err)
+			}
+			if err := decrypter.Decrypt(data, ""); err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+
+			if got, want := testMdat(t, data), bytes.Join(plain, nil); !bytes.Equal(got, want) {
+				t.Errorf("decrypted samples mismatch\n got %x\nwant %x", got, want)
+			}
+			headers := data[:len(data)-len(testMdat(t, data))]
+			for _, name := range []string{"encv", "sinf", "senc"} {
+				if bytes.Contains(headers, []byte(name)) {
+					t.Errorf("%s box left in decrypted output", name)
+				}
+			}
+			if !bytes.Contains(data[:initSize], []byte("avc1")) {
+				t.Error("sample entry not restored to avc1")
+			}
+		})
+	}
+}
+
+func TestCENCDecrypterCBCSKnownAnswer(t *testing.T) {
+	// Encrypted with openssl aes-128-cbc -nopad over the 1:9 pattern blocks of each subsample.
+	const encrypted = "030a11181f262d343b4272c4f1c9184bbc6c891493d9a5d3e9eab9c0c7ced5dce3eaf1f8ff060d141b222930373e454c" +
+		"535a61686f767d848b9299a0a7aeb5bcc3cad1d8dfe6edf4fb020910171e252c333a41484f565d646b727980878e959c" +
+		"a3aab1b8bfc6cdd4dbe2e9f0f7fe050c131a21282f363d444b525960676e757c838a91989fa6adb4bbc2c9d0d7dee5ec" +
+		"f3fa01080f161d242b323940474e555c636a71787f868d949ba28629ccee037a8c7fd587067b6672422d1920272e353c" +
+		"434a512abc93374cf3f056ab378b90e58bccc1c8cfd6dde4ebf2f900070e151c232a31383f464d545b6269"
+	subsamples := []cencSubsample{{ClearBytes: 10, ProtectedBytes: 180}, {ClearBytes: 5, ProtectedBytes: 40}}
+
+	tenc := testTenc(1, 1, 9, 0, testKID, mustHex("000102030405060708090a0b0c0d0e0f"))
+	data := testInit(1, "cbcs", tenc)
+	data = append(data, testFragment(1, [][]byte{mustHex(encrypted)}, nil, func(uint32) [][]byte {
+		return [][]byte{testFullBox("senc", 0, 0x2, be32(1), testAuxEntry(nil, subsamples))}
+	})...)
+
+	decrypter, err := NewCENCDecrypter([]string{hex.EncodeToString(testKID) + ":" + hex.EncodeToString(testKey)})
+	if err != nil {
+		t.Fatalf("NewCENCDecrypter: %v", err)
+	}
+	if err := decrypter.Decrypt(data, ""); err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if got, want := testMdat(t, data), testPlainSample(235, 3); !bytes.Equal(got, want) {
+		t.Errorf("decrypted sample mismatch\n got %x\nwant %x", got, want)
+	}
+}
+
+func TestCENCDecrypterAuxiliaryInfo(t *testing.T) {
+	subsamples := []cencSubsample{{ClearBytes: 6, ProtectedBytes: 50}}
+	plain := [][]byte{testPlainSample(56, 1), testPlainSample(56, 2)}
+	ivs := [][]byte{mustHex("1111111111111111"), mustHex("2222222222222222")}
+
+	encrypt := func(key []byte, subsamples []cencSubsample) ([][]byte, [][]byte) {
+		var samples, entries [][]byte
+		for i, sample := range plain {
+			samples = append(samples, encryptTestSample(t, key, "cenc", ivs[i], 0, 0, subsamples, sample))
+			entries = append(entries, testAuxEntry(ivs[i], subsamples))
+		}
+		return samples, entries
+	}
+
+	tests := []struct {
+		name string
+		keys []string
+		data func() []byte
+	}{
+		{
+			name: "saiz and saio pointing into mdat",
+			keys: []string{hex.EncodeToString(testKID) + ":" + hex.EncodeToString(testKey)},
+			data: func() []byte {
+				samples, entries := encrypt(testKey, subsamples)
+				sizes := []byte{byte(len(entries[0])), byte(len(entries[1]))}
+				init := testInit(1, "cenc", testTenc(0, 0, 0, 8, testKID, nil))
+				return append(init, testFragment(1, samples, bytes.Join(entries, nil), func(auxOffset uint32) [][]byte {
+					return [][]byte{
+						testFullBox("saiz", 0, 0, []byte{0}, be32(2), sizes),
+						testFullBox("saio", 0, 0, be32(1), be32(auxOffset)),
+					}
+				})...)
+			},
+		},
+		{
+			name: "saiz default size without subsamples, track key",
+			keys: []string{"1:" + hex.EncodeToString(testKey)},
+			data: func() []byte {
+				samples, entries := encrypt(testKey, nil)
+				init := testInit(1, "cenc", testTenc(0, 0, 0, 8, testKID, nil))
+				return append(init, testFragment(1, samples, bytes.Join(entries, nil), func(auxOffset uint32) [][]byte {
+					return [][]byte{
+						testFullBox("saiz", 0, 0, []byte{8}, be32(2)),
+						testFullBox("saio", 0, 0, be32(1), be32(auxOffset)),
+					}
+				})...)
+			},
+		},
+		{
+			name: "PIFF sample encryption box with KID override",
+			keys: []string{
+				hex.EncodeToString(testKID) + ":" + hex.EncodeToString(testKey),
+				hex.EncodeToString(testKID2) + ":" + hex.EncodeToString(testKey2),
+			},
+			data: func() []byte {
+				samples, entries := encrypt(testKey2, subsamples)
+				override := append([]byte{0, 0, 1, 8}, testKID2...)
+				piff := testBox("uuid", piffSampleEncryptionUUID, be32(0x3), override, be32(2), bytes.Join(entries, nil))
+				return testFragment(1, samples, nil, func(uint32) [][]byte { return [][]byte{piff} })
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.data()
+			decrypter, err := NewCENCDecrypter(tt.keys)
+			if err != nil {
+				t.Fatalf("NewCENCDecrypter: %v", err)
+			}
+			if err := decrypter.Decrypt(data, ""); err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			want := bytes.Join(plain, nil)
+			if got := testMdat(t, data)[:len(want)]; !bytes.Equal(got, want) {
+				t.Errorf("decrypted samples mismatch\n got %x\nwant %x", got, want)
+			}
+		})
+	}
+}
+
+func TestDecryptMP4NativeSeparateInit(t *testing.T) {
+	// A cbcs media segment can only be decrypted with the scheme and constant IV from its init segment.
+	constantIV := mustHex("0f0e0d0c0b0a09080706050403020100")
+	subsamples := []cencSubsample{{ClearBytes: 3, ProtectedBytes: 200}}
+	plain := testPlainSample(203, 5)
+	sample := encryptTestSample(t, testKey, "cbcs", constantIV, 1, 9, subsamples, plain)
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"init.mp4": testInit(1, "cbcs", testTenc(1, 1, 9, 0, testKID, constantIV)),
+		"seg.m4s": testFragment(1, [][]byte{sample}, nil, func(uint32) [][]byte {
+			return [][]byte{testFullBox("senc", 0, 0x2, be32(1), testAuxEntry(nil, subsamples))}
+		}),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys := []string{hex.EncodeToString(testKID) + ":" + hex.EncodeToString(testKey)}
+	state := &NativeDecryptState{}
+	for _, name := range []string{"init.mp4", "seg.m4s"} {
+		path := filepath.Join(dir, name)
+		if err := DecryptMP4Native(keys, path, path+".dec", "", state); err != nil {
+			t.Fatalf("DecryptMP4Native(%s): %v", name, err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "seg.m4s.dec"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testMdat(t, data); !bytes.Equal(got, plain) {
+		t.Errorf("decrypted sample mismatch\n got %x\nwant %x", got, plain)
+	}
+}
@@ -1,54 +1,34 @@
 package util
 
 import (
-	"bufio"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 )
 
-// SearchKeyFromFile searches for a key in a text file based on the KID.
-// The expected format in the file is KID:KEY.
-func SearchKeyFromFile(keyTextFile, kid string) (string, error) {
-	if keyTextFile == "" || kid == "" {
-		return "", nil
-	}
-
-	file, err := os.Open(keyTextFile)
-	if err != nil {
-		return "", fmt.Errorf("failed to open key file: %w", err)
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if strings.HasPrefix(line, "--key") {
-			line = strings.TrimPrefix(line, "--key ")
-		}
-		parts := strings.Split(line, ":")
-		if len(parts) == 2 {
-			fileKid := strings.ReplaceAll(parts[0], "-", "")
-			fileKey := parts[1]
-			if strings.EqualFold(fileKid, strings.ReplaceAll(kid, "-", "")) {
-				Logger.Info("从文件 %s 中找到KID %s", keyTextFile, kid)
-				return fmt.Sprintf("%s:%s", kid, fileKey), nil
+// Decrypt decrypts a file with the selected engine. NATIVE runs in process, other engines invoke an external tool.
+// state carries the init segment's track defaults between segments of one stream and is only used by NATIVE.
+func Decrypt(decryptEngine, decryptionBinaryPath string, keys []string, encFile, decFile, kid string, state *NativeDecryptState, task *Task) (bool, error) {
+	switch strings.ToUpper(decryptEngine) {
+	case "NATIVE":
+		if err := DecryptMP4Native(keys, encFile, decFile, kid, state); err != nil {
+			err = fmt.Errorf("原生解密失败: %w", err)
+			if task != nil {
+				task.SetError(err)
 			}
+			Logger.Error(err.Error())
+			return false, err
 		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("failed to read key file: %w", err)
-	}
-
-	return "", nil // Not found
-}
-
-// Decrypt invokes an external decryption tool to decrypt a file.
-func Decrypt(decryptEngine, decryptionBinaryPath string, keys []string, encFile, decFile, kid string, task *Task) (bool, error) {
-	if decryptEngine != "MP4DECRYPT" {
-		// For now, only MP4DECRYPT is supported for CENC.
+		if task != nil {
+			task.Increment(1)
+		}
+		Logger.Debug("解密成功: %s", decFile)
+		return true, nil
+	case "MP4DECRYPT", "SHAKA":
+	default:
 		// AES-128 is handled internally.
 		return false, fmt.Errorf("unsupported decrypt engine for this function: %s", decryptEngine)
 	}
@@ -69,7 +49,8 @@ func Decrypt(decryptEngine, decryptionBinaryPath string, keys []string, encFile,
 			args = append(args, "--key", key)
 		}
 		args = append(args, encFile, decFile)
-	// Add other engines like SHAKA_PACKAGER later
+	case "SHAKA":
+		args = shakaPackagerArgs(keys, encFile, decFile, kid)
 	default:
 		err := fmt.Errorf("不支持的解密引擎: %s", decryptEngine)
 		if task != nil {
@@ -97,3 +78,132 @@ func Decrypt(decryptEngine, decryptionBinaryPath string, keys []string, encFile,
 	Logger.Info("解密成功: %s", decFile)
 	return true, nil
 }
+
+// shakaPackagerArgs builds the packager command line for raw key decryption.
+// The stream is selected by the track type of the input so that packager picks the protected track.
+// Packager stores raw keys by label and rejects duplicate labels, so every key gets one: the key of
+// the stream's KID is labelled after the stream type and referenced through drm_label, the others get
+// a numbered label of the same type. Decryption itself looks keys up by key_id.
+func shakaPackagerArgs(keys []string, encFile, decFile, kid string) []string {
+	stream := shakaStreamSelector(encFile)
+	label := strings.ToUpper(stream)
+	if stream == "0" {
+		label = "MEDIA"
+	}
+	kid = NormalizeKID(kid)
+
+	var keyArgs []string
+	streamKeyFound := false
+	for _, key := range keys {
+		parts := strings.SplitN(strings.TrimSpace(key), ":", 2)
+		if len(parts) != 2 || NormalizeKID(parts[0]) == "" {
+			if len(parts) == 2 {
+				// Shaka Packager only accepts keys by key_id.
+				Logger.Warn("Shaka Packager不支持按轨道ID指定的密钥，已忽略: %s", parts[0])
+			}
+			continue
+		}
+		keyID := NormalizeKID(parts[0])
+		keyLabel := fmt.Sprintf("%s_%d", label, len(keyArgs))
+		if keyID == kid && !streamKeyFound {
+			keyLabel = label
+			streamKeyFound = true
+		}
+		keyArgs = append(keyArgs, fmt.Sprintf("label=%s:key_id=%s:key=%s", keyLabel, keyID, strings.TrimSpace(parts[1])))
+	}
+
+	descriptor := fmt.Sprintf("in=%s,stream=%s,output=%s", encFile, stream, decFile)
+	if streamKeyFound {
+		descriptor += ",drm_label=" + label
+	}
+	return []string{
+		"--quiet",
+		"--enable_raw_key_decryption",
+		descriptor,
+		"--keys", strings.Join(keyArgs, ","),
+	}
+}
+
+// shakaStreamSelector returns the packager stream selector (video, audio or text) of the first track,
+// or the stream index 0 when the type cannot be determined.
+func shakaStreamSelector(file string) string {
+	moov, err := readTopLevelBox(file, "moov")
+	if err != nil || moov == nil {
+		return "0"
+	}
+
+	var handlerType string
+	parser := NewMP4Parser().
+		Box("moov", Children).
+		Box("trak", Children).
+		Box("mdia", Children).
+		Box("hdlr", AllData(func(data []byte) {
+			// version/flags, pre_defined, handler_type
+			if handlerType == "" && len(data) >= 12 {
+				handlerType = string(data[8:12])
+			}
+		}))
+	if err := parser.Parse(moov); err != nil {
+		return "0"
+	}
+
+	switch handlerType {
+	case "vide":
+		return "video"
+	case "soun":
+		return "audio"
+	case "text", "subt", "sbtl":
+		return "text"
+	default:
+		return "0"
+	}
+}
+
+// readTopLevelBox reads a single top-level box of a file without loading the rest of it,
+// which keeps the lookup cheap for large merged outputs. It returns nil if the box is absent.
+func readTopLevelBox(file, name string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 16)
+	var offset int64
+	for {
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			info, err := f.Stat()
+			if err != nil {
+				return nil, err
+			}
+			size = info.Size() - offset
+		case 1:
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize {
+			return nil, fmt.Errorf("invalid box size at offset %d", offset)
+		}
+
+		if string(header[4:8]) == name {
+			box := make([]byte, size)
+			if _, err := f.ReadAt(box, offset); err != nil {
+				return nil, err
+			}
+			return box, nil
+		}
+		offset += size
+	}
+}
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// EmsgBox is a parsed DASH event message box.
+type EmsgBox struct {
+	Version     uint8
+	SchemeIDURI string
+	Value       string
+	Timescale   uint32
+	// PresentationTime is absolute for version 1 boxes.
+	PresentationTime uint64
+	// PresentationTimeDelta is relative to the segment start for version 0 boxes.
+	PresentationTimeDelta uint32
+	EventDuration         uint32
+	ID                    uint32
+	MessageData           []byte
+}
+
+// ParseEmsgBoxes parses all top-level emsg boxes in an fMP4 segment.
+func ParseEmsgBoxes(data []byte) []*EmsgBox {
+	var boxes []*EmsgBox
+
+	parser := NewMP4Parser().
+		FullBox("emsg", func(box *Box) {
+			if emsg := parseEmsgBox(box); emsg != nil {
+				boxes = append(boxes, emsg)
+			}
+		})
+
+	if err := parser.Parse(data); err != nil {
+		Logger.Debug("parse emsg boxes: %v", err)
+	}
+	return boxes
+}
+
+func parseEmsgBox(box *Box) *EmsgBox {
+	r := box.Reader
+	emsg := &EmsgBox{Version: *box.Version}
+
+	var ok bool
+	if emsg.Version == 0 {
+		if emsg.SchemeIDURI, ok = readCString(r); !ok {
+			return nil
+		}
+		if emsg.Value, ok = readCString(r); !ok {
+			return nil
+		}
+		if r.Len() < 16 {
+			return nil
+		}
+		emsg.Timescale = binary.BigEndian.Uint32(readBytes(r, 4))
+		emsg.PresentationTimeDelta = binary.BigEndian.Uint32(readBytes(r, 4))
+		emsg.EventDuration = binary.BigEndian.Uint32(readBytes(r, 4))
+		emsg.ID = binary.BigEndian.Uint32(readBytes(r, 4))
+	} else {
+		if r.Len() < 20 {
+			return nil
+		}
+		emsg.Timescale = binary.BigEndian.Uint32(readBytes(r, 4))
+		emsg.PresentationTime = binary.BigEndian.Uint64(readBytes(r, 8))
+		emsg.EventDuration = binary.BigEndian.Uint32(readBytes(r, 4))
+		emsg.ID = binary.BigEndian.Uint32(readBytes(r, 4))
+		if emsg.SchemeIDURI, ok = readCString(r); !ok {
+			return nil
+		}
+		if emsg.Value, ok = readCString(r); !ok {
+			return nil
+		}
+	}
+
+	emsg.MessageData, _ = io.ReadAll(r)
+	return emsg
+}
+
+func readCString(r *bytes.Reader) (string, bool) {
+	var buf []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", false
+		}
+		if b == 0 {
+			return string(buf), true
+		}
+		buf = append(buf, b)
+	}
+}
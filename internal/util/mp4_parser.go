@@ -10,8 +10,18 @@ import (
 
 // ParsedMP4Info holds information extracted from an MP4 file.
 type ParsedMP4Info struct {
-	KID        string
+	// KID is the primary KID: the tenc default_KID, or the first KID found in a pssh box.
+	KID string
+	// KIDs lists every distinct KID from tenc and all pssh boxes.
+	KIDs []string
+	// TencKIDs lists only the default_KIDs of the tenc boxes, i.e. the KIDs the tracks are encrypted with.
+	TencKIDs []string
+	// PSSH holds the parsed pssh boxes with their systems and KIDs.
+	PSSH []*PSSHInfo
+	// IsMultiDRM is set when pssh boxes of more than one DRM system are present.
 	IsMultiDRM bool
+	// Scheme is the protection scheme type from schm (cenc, cens, cbc1 or cbcs).
+	Scheme string
 }
 
 // Box represents a parsed MP4 box.
@@ -28,6 +38,16 @@ type Box struct {
 	absStart   uint64
 }
 
+// AbsStart returns the offset of the box header relative to the start of the parsed data.
+func (b *Box) AbsStart() uint64 {
+	return b.absStart
+}
+
+// AbsEnd returns the offset just past the end of the box relative to the start of the parsed data.
+func (b *Box) AbsEnd() uint64 {
+	return b.absStart + b.Size
+}
+
 // MP4Parser is a parser for MP4 file structures (boxes).
 type MP4Parser struct {
 	boxDefs map[string]func(*Box)
@@ -102,7 +122,7 @@ func (p *MP4Parser) parseNext(reader *bytes.Reader, absStart uint64) error {
 		Size:       size,
 		parser:     p,
 		headerSize: headerSize,
-		absStart:   absStart + (startPos - uint64(reader.Len())),
+		absStart:   absStart + (uint64(reader.Size()) - startPos),
 	}
 
 	handler, ok := p.boxDefs[name]
@@ -176,7 +196,9 @@ func AllData(handler func([]byte)) func(*Box) {
 	return func(box *Box) {
 		payload := make([]byte, box.Reader.Len())
 		box.Reader.Read(payload)
-		handler(payload)
+		if handler != nil {
+			handler(payload)
+		}
 	}
 }
 
@@ -185,6 +207,8 @@ func (p *MP4Parser) isFullBox(name string) bool {
 	// of known full boxes. For this use case, we'll define them as needed.
 	fullBoxes := map[string]bool{
 		"mdhd": true, "tfdt": true, "tfhd": true, "trun": true, "stsd": true, "pssh": true,
+		"sidx": true, "emsg": true, "tkhd": true, "trex": true, "schm": true, "tenc": true,
+		"senc": true, "saiz": true, "saio": true,
 	}
 	return fullBoxes[name]
 }
@@ -201,9 +225,13 @@ func GetMP4Info(filePath string) (*ParsedMP4Info, error) {
 	if err != nil {
 		return nil, err
 	}
+	return GetMP4InfoFromBytes(data)
+}
 
+// GetMP4InfoFromBytes parses MP4 data held in memory and returns extracted information.
+func GetMP4InfoFromBytes(data []byte) (*ParsedMP4Info, error) {
 	info := &ParsedMP4Info{}
-	var psshData [][]byte
+	var tencKIDs []string
 
 	parser := NewMP4Parser().
 		Box("moov", Children).
@@ -211,31 +239,59 @@ func GetMP4Info(filePath string) (*ParsedMP4Info, error) {
 		Box("mdia", Children).
 		Box("minf", Children).
 		Box("stbl", Children).
+		Box("moof", Children).
 		Box("stsd", SampleDescription).
-		Box("encv", Children).
-		Box("enca", Children).
+		// Skip the visual and audio sample entry fields before the child boxes.
+		Box("encv", func(b *Box) {
+			b.Reader.Seek(78, io.SeekCurrent)
+			Children(b)
+		}).
+		Box("enca", func(b *Box) {
+			b.Reader.Seek(28, io.SeekCurrent)
+			Children(b)
+		}).
 		Box("sinf", Children).
-		Box("frma", AllData(nil)).
-		Box("schm", AllData(nil)).
 		Box("schi", Children).
-		Box("tenc", AllData(nil)).
+		FullBox("schm", func(b *Box) {
+			if b.Reader.Len() >= 4 && info.Scheme == "" {
+				info.Scheme = string(readBytes(b.Reader, 4))
+			}
+		}).
+		FullBox("tenc", func(b *Box) {
+			// reserved, pattern/reserved, default_isProtected, default_Per_Sample_IV_Size, default_KID
+			if b.Reader.Len() < 20 {
+				return
+			}
+			payload := readBytes(b.Reader, 20)
+			if payload[2] != 0 {
+				tencKIDs = appendUniqueKID(tencKIDs, fmt.Sprintf("%x", payload[4:20]))
+			}
+		}).
 		FullBox("pssh", func(b *Box) {
 			payload := make([]byte, b.Reader.Len())
 			b.Reader.Read(payload)
-			psshData = append(psshData, payload)
+			if pssh, err := parsePSSHPayload(*b.Version, payload); err == nil {
+				info.PSSH = append(info.PSSH, pssh)
+			}
 		})
 
 	if err := parser.Parse(data); err != nil {
 		return nil, err
 	}
 
-	// Widevine PSSH box
-	for _, pssh := range psshData {
-		if len(pssh) > 32 && (bytes.Equal(pssh[12:28], []byte{0xed, 0xef, 0x8b, 0xa9, 0x79, 0xd6, 0x4a, 0xce, 0xa3, 0xc8, 0x27, 0xdc, 0xd5, 0x1d, 0x21, 0xed})) {
-			info.KID = fmt.Sprintf("%x", pssh[len(pssh)-16:])
-			break
+	info.TencKIDs = tencKIDs
+	info.KIDs = append([]string(nil), tencKIDs...)
+	systems := make(map[string]bool)
+	for _, pssh := range info.PSSH {
+		systems[pssh.SystemID] = true
+		for _, kid := range pssh.KIDs {
+			info.KIDs = appendUniqueKID(info.KIDs, kid)
 		}
 	}
+	info.IsMultiDRM = len(systems) > 1
+	if len(info.KIDs) > 0 {
+		info.KID = info.KIDs[0]
+	}
 
 	return info, nil
 }
@@ -0,0 +1,110 @@
+package util
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// SidxReference is a single reference entry of a sidx box.
+type SidxReference struct {
+	// IsSidx reports whether the reference points to another sidx box (hierarchical index).
+	IsSidx bool
+	// Offset is the absolute byte offset of the referenced subsegment in the file.
+	Offset int64
+	// Size is the byte length of the referenced subsegment.
+	Size int64
+	// Duration is the subsegment duration in timescale units.
+	Duration uint64
+	// StartsWithSAP reports whether the subsegment starts with a stream access point.
+	StartsWithSAP bool
+}
+
+// SidxInfo holds the information parsed from a sidx box.
+type SidxInfo struct {
+	Timescale                uint32
+	EarliestPresentationTime uint64
+	References               []SidxReference
+}
+
+// ParseSidx parses the first sidx box found in data.
+// dataOffset is the absolute file offset of data[0], so that the returned
+// reference offsets can be used directly as byte ranges of the media file.
+func ParseSidx(data []byte, dataOffset int64) (*SidxInfo, error) {
+	var info *SidxInfo
+	var parseErr error
+
+	parser := NewMP4Parser().
+		FullBox("sidx", func(box *Box) {
+			if info != nil {
+				return
+			}
+			info, parseErr = parseSidxBox(box, dataOffset)
+		})
+
+	if err := parser.Parse(data); err != nil && info == nil {
+		return nil, err
+	}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	if info == nil {
+		return nil, fmt.Errorf("sidx box not found")
+	}
+	return info, nil
+}
+
+func parseSidxBox(box *Box, dataOffset int64) (*SidxInfo, error) {
+	r := box.Reader
+	version := *box.Version
+
+	headerLen := 12
+	if version != 0 {
+		headerLen = 20
+	}
+	if r.Len() < headerLen+4 {
+		return nil, fmt.Errorf("sidx box too short")
+	}
+
+	info := &SidxInfo{}
+	readBytes(r, 4) // reference_ID
+	info.Timescale = binary.BigEndian.Uint32(readBytes(r, 4))
+	if info.Timescale == 0 {
+		return nil, fmt.Errorf("invalid sidx timescale")
+	}
+
+	var firstOffset uint64
+	if version == 0 {
+		info.EarliestPresentationTime = uint64(binary.BigEndian.Uint32(readBytes(r, 4)))
+		firstOffset = uint64(binary.BigEndian.Uint32(readBytes(r, 4)))
+	} else {
+		info.EarliestPresentationTime = binary.BigEndian.Uint64(readBytes(r, 8))
+		firstOffset = binary.BigEndian.Uint64(readBytes(r, 8))
+	}
+
+	readBytes(r, 2) // reserved
+	count := int(binary.BigEndian.Uint16(readBytes(r, 2)))
+	if r.Len() < count*12 {
+		return nil, fmt.Errorf("sidx reference count %d exceeds box size", count)
+	}
+
+	// Offsets are relative to the first byte following the sidx box.
+	offset := dataOffset + int64(box.AbsEnd()) + int64(firstOffset)
+	info.References = make([]SidxReference, 0, count)
+	for i := 0; i < count; i++ {
+		typeAndSize := binary.BigEndian.Uint32(readBytes(r, 4))
+		duration := binary.BigEndian.Uint32(readBytes(r, 4))
+		sap := binary.BigEndian.Uint32(readBytes(r, 4))
+
+		ref := SidxReference{
+			IsSidx:        typeAndSize>>31 == 1,
+			Offset:        offset,
+			Size:          int64(typeAndSize & 0x7fffffff),
+			Duration:      uint64(duration),
+			StartsWithSAP: sap>>31 == 1,
+		}
+		info.References = append(info.References, ref)
+		offset += ref.Size
+	}
+
+	return info, nil
+}
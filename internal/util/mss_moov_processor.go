@@ -3,6 +3,7 @@ package util
 import (
 	"N_m3u8DL-RE-GO/internal/entity"
 	"bytes"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
@@ -81,17 +82,28 @@ func NewMSSMoovProcessor(spec *entity.StreamSpec) (*MSSMoovProcessor, error) {
 		p.Language = spec.Language
 	}
 
-	// Further initialization can be added here, like GenCodecPrivateDataForAAC and ExtractKID
-	// For now, we'll keep it simple and add them in subsequent steps.
+	// The parser already converted the PlayReady KID to CENC byte order; fall back to decoding the header here.
+	if p.IsProtection {
+		p.ProtectionKID = NormalizeKID(spec.DefaultKID)
+		if p.ProtectionKID == "" && p.ProtectionData != "" {
+			if header, err := ParsePlayReadyHeaderBase64(p.ProtectionData); err == nil {
+				p.ProtectionKID = header.KID()
+			} else {
+				Logger.Warn("Failed to parse PlayReady header: %v", err)
+			}
+		}
+	}
+
+	// Further initialization can be added here, like GenCodecPrivateDataForAAC.
 
 	return p, nil
 }
 
 // CanHandle checks if the given fourCC is supported by the MSSMoovProcessor.
 func CanHandle(fourCC string) bool {
-	supported := []string{"HVC1", "HEV1", "AACL", "AACH", "EC-3", "H264", "AVC1", "DAVC", "TTML", "DVHE", "DVH1"}
+	supported := []string{"HVC1", "HEV1", "AACL", "AACH", "EC-3", "AC-3", "DTSC", "DTSE", "DTSH", "DTSL", "H264", "AVC1", "DAVC", "TTML", "DFXP", "DVHE", "DVH1"}
 	for _, s := range supported {
-		if s == fourCC {
+		if s == strings.ToUpper(fourCC) {
 			return true
 		}
 	}
@@ -125,7 +137,9 @@ func (p *MSSMoovProcessor) genMoov() []byte {
 	moovPayload = append(moovPayload, p.genMvhd()...)
 	moovPayload = append(moovPayload, p.genTrak()...)
 	moovPayload = append(moovPayload, p.genMvex()...)
-	// TODO: Add pssh box if protection is enabled
+	if p.IsProtection {
+		moovPayload = append(moovPayload, p.genPssh()...)
+	}
 	return box("moov", moovPayload)
 }
 
@@ -258,7 +272,7 @@ func (p *MSSMoovProcessor) genStbl() []byte {
 func (p *MSSMoovProcessor) genStsd() []byte {
 	sampleEntryBox, err := p.getSampleEntryBox()
 	if err != nil {
-		// In a real implementation, handle this error properly
+		Logger.Warn("Failed to generate sample entry for %s: %v", p.FourCC, err)
 		return []byte{}
 	}
 	stsdPayload := append([]byte{0, 0, 0, 1}, sampleEntryBox...)
@@ -285,10 +299,20 @@ func (p *MSSMoovProcessor) getSampleEntryBox() ([]byte, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid codec private data: %w", err)
 		}
-		buf.Write(p.genEsds(codecPrivateBytes))
-
-		// TODO: Handle protection ('enca')
-		return box("mp4a", buf.Bytes()), nil
+		switch fourCC := strings.ToUpper(p.FourCC); fourCC {
+		case "EC-3":
+			buf.Write(p.getDec3(codecPrivateBytes))
+			return p.sampleEntry("ec-3", buf.Bytes()), nil
+		case "AC-3":
+			buf.Write(p.getDac3())
+			return p.sampleEntry("ac-3", buf.Bytes()), nil
+		case "DTSC", "DTSE", "DTSH", "DTSL":
+			buf.Write(p.getDdts())
+			return p.sampleEntry(strings.ToLower(fourCC), buf.Bytes()), nil
+		default:
+			buf.Write(p.genEsds(codecPrivateBytes))
+			return p.sampleEntry("mp4a", buf.Bytes()), nil
+		}
 
 	case "video":
 		buf.Write(make([]byte, 16)) // pre_defined, reserved
@@ -302,28 +326,296 @@ func (p *MSSMoovProcessor) getSampleEntryBox() ([]byte, error) {
 		binary.Write(buf, binary.BigEndian, uint16(0x0018))     // depth
 		binary.Write(buf, binary.BigEndian, int16(-1))          // pre_defined
 
-		if p.FourCC == "H264" || p.FourCC == "AVC1" {
-			// TODO: Implement GetAvcC
-			// buf.Write(p.getAvcC())
-			return box("avc1", buf.Bytes()), nil
-		}
-		if p.FourCC == "HVC1" || p.FourCC == "HEV1" {
-			// TODO: Implement GetHvcC
-			// buf.Write(p.getHvcC())
-			return box("hvc1", buf.Bytes()), nil
+		switch fourCC := strings.ToUpper(p.FourCC); fourCC {
+		case "H264", "AVC1", "DAVC":
+			avcC, err := p.getAvcC()
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(avcC)
+			return p.sampleEntry("avc1", buf.Bytes()), nil
+		case "HVC1", "HEV1", "DVH1", "DVHE":
+			hvcC, err := p.getHvcC()
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(hvcC)
+			return p.sampleEntry(strings.ToLower(fourCC), buf.Bytes()), nil
 		}
-		// TODO: Handle protection ('encv')
 		return nil, fmt.Errorf("unsupported video fourCC: %s", p.FourCC)
 
 	case "text":
-		// TODO: Implement TTML ('stpp') entry
-		return nil, fmt.Errorf("text stream type not yet implemented")
+		// XMLSubtitleSampleEntry: namespace, schema_location, auxiliary_mime_types
+		buf.WriteString("http://www.w3.org/ns/ttml\x00")
+		buf.WriteString("\x00")
+		buf.WriteString("\x00")
+		return box("stpp", buf.Bytes()), nil
 
 	default:
 		return nil, fmt.Errorf("unsupported stream type: %s", p.StreamType)
 	}
 }
 
+// getAvcC creates the 'avcC' (AVC Decoder Configuration) box from the Annex B SPS/PPS in CodecPrivateData.
+func (p *MSSMoovProcessor) getAvcC() ([]byte, error) {
+	privateData, err := hex.DecodeString(p.CodecPrivateData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid codec private data: %w", err)
+	}
+
+	var spsList, ppsList [][]byte
+	for _, nal := range splitAnnexB(privateData) {
+		switch nal[0] & 0x1F {
+		case 7:
+			spsList = append(spsList, nal)
+		case 8:
+			ppsList = append(ppsList, nal)
+		}
+	}
+	if len(spsList) == 0 || len(spsList[0]) < 4 {
+		return nil, fmt.Errorf("no SPS found in codec private data")
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteByte(1)             // configurationVersion
+	buf.WriteByte(spsList[0][1]) // AVCProfileIndication
+	buf.WriteByte(spsList[0][2]) // profile_compatibility
+	buf.WriteByte(spsList[0][3]) // AVCLevelIndication
+	buf.WriteByte(0xFC | p.lengthSizeMinusOne())
+	buf.WriteByte(0xE0 | byte(len(spsList)))
+	for _, sps := range spsList {
+		binary.Write(buf, binary.BigEndian, uint16(len(sps)))
+		buf.Write(sps)
+	}
+	buf.WriteByte(byte(len(ppsList)))
+	for _, pps := range ppsList {
+		binary.Write(buf, binary.BigEndian, uint16(len(pps)))
+		buf.Write(pps)
+	}
+	return box("avcC", buf.Bytes()), nil
+}
+
+// getHvcC creates the 'hvcC' (HEVC Decoder Configuration) box from the Annex B VPS/SPS/PPS in CodecPrivateData.
+func (p *MSSMoovProcessor) getHvcC() ([]byte, error) {
+	privateData, err := hex.DecodeString(p.CodecPrivateData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid codec private data: %w", err)
+	}
+
+	arrays := map[byte][][]byte{}
+	for _, nal := range splitAnnexB(privateData) {
+		nalType := (nal[0] >> 1) & 0x3F
+		if nalType == hevcNalVPS || nalType == hevcNalSPS || nalType == hevcNalPPS {
+			arrays[nalType] = append(arrays[nalType], nal)
+		}
+	}
+	if len(arrays[hevcNalSPS]) == 0 {
+		return nil, fmt.Errorf("no SPS found in codec private data")
+	}
+	sps, err := parseHEVCSPS(arrays[hevcNalSPS][0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HEVC SPS: %w", err)
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteByte(1) // configurationVersion
+	buf.WriteByte(sps.ProfileSpace<<6 | sps.TierFlag<<5 | sps.ProfileIdc)
+	binary.Write(buf, binary.BigEndian, sps.CompatibilityFlags)
+	buf.Write(sps.ConstraintFlags[:])
+	buf.WriteByte(sps.LevelIdc)
+	binary.Write(buf, binary.BigEndian, uint16(0xF000)) // min_spatial_segmentation_idc
+	buf.WriteByte(0xFC)                                 // parallelismType
+	buf.WriteByte(0xFC | sps.ChromaFormatIdc)
+	buf.WriteByte(0xF8 | sps.BitDepthLumaMinus8)
+	buf.WriteByte(0xF8 | sps.BitDepthChromaM8)
+	binary.Write(buf, binary.BigEndian, uint16(0)) // avgFrameRate
+	temporalIDNested := byte(0)
+	if sps.TemporalIDNested {
+		temporalIDNested = 1
+	}
+	buf.WriteByte((sps.MaxSubLayersMinus1+1)<<3 | temporalIDNested<<2 | p.lengthSizeMinusOne())
+
+	var numArrays byte
+	for _, nalType := range []byte{hevcNalVPS, hevcNalSPS, hevcNalPPS} {
+		if len(arrays[nalType]) > 0 {
+			numArrays++
+		}
+	}
+	buf.WriteByte(numArrays)
+	for _, nalType := range []byte{hevcNalVPS, hevcNalSPS, hevcNalPPS} {
+		nalus := arrays[nalType]
+		if len(nalus) == 0 {
+			continue
+		}
+		buf.WriteByte(0x80 | nalType) // array_completeness
+		binary.Write(buf, binary.BigEndian, uint16(len(nalus)))
+		for _, nal := range nalus {
+			binary.Write(buf, binary.BigEndian, uint16(len(nal)))
+			buf.Write(nal)
+		}
+	}
+	return box("hvcC", buf.Bytes()), nil
+}
+
+// lengthSizeMinusOne returns the NAL length field size for avcC/hvcC.
+func (p *MSSMoovProcessor) lengthSizeMinusOne() byte {
+	if p.NalUnitLengthField < 1 || p.NalUnitLengthField > 4 {
+		return 3
+	}
+	return byte(p.NalUnitLengthField - 1)
+}
+
+// getDec3 creates the 'dec3' (E-AC-3 Specific) box.
+// Smooth Streaming stores a WAVEFORMATEXTENSIBLE extension (22 bytes) followed by the dec3 payload in CodecPrivateData;
+// when that is missing, a single independent substream is described from the manifest attributes.
+func (p *MSSMoovProcessor) getDec3(codecPrivateData []byte) []byte {
+	if len(codecPrivateData) >= 22+5 {
+		return box("dec3", codecPrivateData[22:])
+	}
+
+	acmod, lfeon := p.ac3ChannelMode()
+	dataRate := uint32(0)
+	if p.StreamSpec.Bandwidth != nil {
+		dataRate = uint32(*p.StreamSpec.Bandwidth / 1000)
+	}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, uint16(dataRate&0x1FFF)<<3) // data_rate, num_ind_sub = 0
+	// fscod(2) bsid(5) reserved(1) asvc(1) bsmod(3) acmod(3) lfeon(1) reserved(3) num_dep_sub(4) reserved(1)
+	sub := p.ac3Fscod()<<22 | 16<<17 | acmod<<9 | lfeon<<8
+	buf.Write([]byte{byte(sub >> 16), byte(sub >> 8), byte(sub)})
+	return box("dec3", buf.Bytes())
+}
+
+// getDac3 creates the 'dac3' (AC-3 Specific) box from the manifest attributes.
+func (p *MSSMoovProcessor) getDac3() []byte {
+	bitRates := []int{32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 448, 512, 576, 640}
+	bitRateCode := uint32(len(bitRates) - 1)
+	if p.StreamSpec.Bandwidth != nil {
+		for i, rate := range bitRates {
+			if rate*1000 >= *p.StreamSpec.Bandwidth {
+				bitRateCode = uint32(i)
+				break
+			}
+		}
+	}
+
+	acmod, lfeon := p.ac3ChannelMode()
+	// fscod(2) bsid(5) bsmod(3) acmod(3) lfeon(1) bit_rate_code(5) reserved(5)
+	v := p.ac3Fscod()<<22 | 8<<17 | acmod<<11 | lfeon<<10 | bitRateCode<<5
+	return box("dac3", []byte{byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
+// ac3Fscod maps the sampling rate to the AC-3 fscod code.
+func (p *MSSMoovProcessor) ac3Fscod() uint32 {
+	switch p.SamplingRate {
+	case 44100:
+		return 1
+	case 32000:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// ac3ChannelMode maps the channel count to AC-3 acmod and lfeon.
+func (p *MSSMoovProcessor) ac3ChannelMode() (acmod uint32, lfeon uint32) {
+	switch p.Channels {
+	case 1:
+		return 1, 0
+	case 3:
+		return 3, 0
+	case 4:
+		return 6, 0
+	case 5:
+		return 7, 0
+	case 6, 7, 8:
+		return 7, 1
+	default:
+		return 2, 0
+	}
+}
+
+// getDdts creates the 'ddts' (DTS Specific) box from the manifest attributes.
+func (p *MSSMoovProcessor) getDdts() []byte {
+	bitrate := uint32(0)
+	if p.StreamSpec.Bandwidth != nil {
+		bitrate = uint32(*p.StreamSpec.Bandwidth)
+	}
+	coreLFE, coreLayout, channelLayout := uint64(0), uint64(2), uint64(0x0002) // L/R
+	if p.Channels >= 6 {
+		coreLFE, coreLayout, channelLayout = 1, 9, 0x000F // C, L/R, Ls/Rs, LFE
+	} else if p.Channels == 1 {
+		coreLayout, channelLayout = 0, 0x0001 // C
+	}
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, p.SamplingRate) // DTSSamplingFrequency
+	binary.Write(buf, binary.BigEndian, bitrate)        // maxBitrate
+	binary.Write(buf, binary.BigEndian, bitrate)        // avgBitrate
+	buf.WriteByte(byte(p.BitsPerSample))                // pcmSampleDepth
+	// FrameDuration(2) StreamConstruction(5) CoreLFEPresent(1) CoreLayout(6) CoreSize(14) StereoDownmix(1)
+	// RepresentationType(3) ChannelLayout(16) MultiAssetFlag(1) LBRDurationMod(1) ReservedBoxPresent(1) Reserved(5)
+	v := coreLFE<<48 | coreLayout<<42 | channelLayout<<8
+	for shift := 48; shift >= 0; shift -= 8 {
+		buf.WriteByte(byte(v >> uint(shift)))
+	}
+	return box("ddts", buf.Bytes())
+}
+
+// sampleEntry wraps a sample entry payload, turning it into 'encv'/'enca' with a 'sinf' box when the stream is protected.
+func (p *MSSMoovProcessor) sampleEntry(format string, payload []byte) []byte {
+	if !p.IsProtection || p.ProtectionKID == "" {
+		return box(format, payload)
+	}
+	entryType := "encv"
+	if p.StreamType == "audio" {
+		entryType = "enca"
+	}
+	return box(entryType, append(payload, p.genSinf(format)...))
+}
+
+// genSinf creates the 'sinf' (Protection Scheme Information) box.
+func (p *MSSMoovProcessor) genSinf(format string) []byte {
+	var sinfPayload []byte
+	sinfPayload = append(sinfPayload, box("frma", []byte(format))...)
+
+	schm := new(bytes.Buffer)
+	schm.WriteString("cenc")
+	binary.Write(schm, binary.BigEndian, uint32(0x00010000)) // scheme_version
+	sinfPayload = append(sinfPayload, fullBox("schm", 0, 0, schm.Bytes())...)
+
+	sinfPayload = append(sinfPayload, box("schi", p.genTenc())...)
+	return box("sinf", sinfPayload)
+}
+
+// genTenc creates the 'tenc' (Track Encryption) box.
+func (p *MSSMoovProcessor) genTenc() []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(make([]byte, 2)) // reserved
+	buf.WriteByte(1)           // default_isProtected
+	buf.WriteByte(8)           // default_Per_Sample_IV_Size, PIFF uses 8-byte IVs
+	kid, _ := hex.DecodeString(p.ProtectionKID)
+	buf.Write(kid)
+	return fullBox("tenc", 0, 0, buf.Bytes())
+}
+
+// genPssh creates the 'pssh' (Protection System Specific Header) box carrying the PlayReady Object.
+func (p *MSSMoovProcessor) genPssh() []byte {
+	data, err := base64.StdEncoding.DecodeString(p.ProtectionData)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	systemID, err := hex.DecodeString(strings.ReplaceAll(NormalizeSystemID(p.ProtectionSystemID), "-", ""))
+	if err != nil || len(systemID) != 16 {
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	buf.Write(systemID)
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+	return fullBox("pssh", 0, 0, buf.Bytes())
+}
+
 // genEsds creates the 'esds' (Elementary Stream Descriptor) box for audio.
 func (p *MSSMoovProcessor) genEsds(audioSpecificConfig []byte) []byte {
 	// Simplified version for now
@@ -0,0 +1,180 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// HEVC NAL unit types used in parameter set arrays.
+const (
+	hevcNalVPS = 32
+	hevcNalSPS = 33
+	hevcNalPPS = 34
+)
+
+// splitAnnexB splits an Annex B byte stream into NAL units without start codes.
+func splitAnnexB(data []byte) [][]byte {
+	var nalus [][]byte
+	start := -1
+	for i := 0; i+2 < len(data); {
+		if data[i] == 0 && data[i+1] == 0 && data[i+2] == 1 {
+			if start >= 0 {
+				nalus = append(nalus, bytes.TrimRight(data[start:i], "\x00"))
+			}
+			i += 3
+			start = i
+			continue
+		}
+		i++
+	}
+	if start >= 0 && start < len(data) {
+		nalus = append(nalus, data[start:])
+	}
+
+	var result [][]byte
+	for _, nal := range nalus {
+		if len(nal) > 0 {
+			result = append(result, nal)
+		}
+	}
+	return result
+}
+
+// removeEmulationPrevention converts a NAL unit payload to its RBSP by dropping 0x000003 escape bytes.
+func removeEmulationPrevention(data []byte) []byte {
+	rbsp := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		rbsp = append(rbsp, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return rbsp
+}
+
+// bitReader reads big-endian bit fields and Exp-Golomb codes.
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *bitReader) readBits(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = fmt.Errorf("unexpected end of bitstream")
+			return 0
+		}
+		bit := (r.data[r.pos/8] >> (7 - uint(r.pos%8))) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) skipBits(n int) {
+	r.pos += n
+	if r.pos > len(r.data)*8 {
+		r.err = fmt.Errorf("unexpected end of bitstream")
+	}
+}
+
+func (r *bitReader) readUE() uint64 {
+	zeros := 0
+	for r.readBits(1) == 0 {
+		if r.err != nil || zeros > 31 {
+			r.err = fmt.Errorf("invalid Exp-Golomb code")
+			return 0
+		}
+		zeros++
+	}
+	return (1<<uint(zeros) - 1) + r.readBits(zeros)
+}
+
+// hevcSPSInfo holds the SPS fields needed to build an hvcC box.
+type hevcSPSInfo struct {
+	ProfileSpace       uint8
+	TierFlag           uint8
+	ProfileIdc         uint8
+	CompatibilityFlags uint32
+	ConstraintFlags    [6]byte
+	LevelIdc           uint8
+	MaxSubLayersMinus1 uint8
+	TemporalIDNested   bool
+	ChromaFormatIdc    uint8
+	BitDepthLumaMinus8 uint8
+	BitDepthChromaM8   uint8
+}
+
+// parseHEVCSPS parses the profile, tier, level, chroma format and bit depth of an HEVC SPS NAL unit.
+func parseHEVCSPS(nal []byte) (*hevcSPSInfo, error) {
+	if len(nal) < 3 {
+		return nil, fmt.Errorf("SPS too short")
+	}
+	r := &bitReader{data: removeEmulationPrevention(nal[2:])} // skip the 2-byte NAL header
+	info := &hevcSPSInfo{}
+
+	r.skipBits(4) // sps_video_parameter_set_id
+	info.MaxSubLayersMinus1 = uint8(r.readBits(3))
+	info.TemporalIDNested = r.readBits(1) == 1
+
+	// profile_tier_level
+	info.ProfileSpace = uint8(r.readBits(2))
+	info.TierFlag = uint8(r.readBits(1))
+	info.ProfileIdc = uint8(r.readBits(5))
+	info.CompatibilityFlags = uint32(r.readBits(32))
+	for i := range info.ConstraintFlags {
+		info.ConstraintFlags[i] = uint8(r.readBits(8))
+	}
+	info.LevelIdc = uint8(r.readBits(8))
+
+	subLayers := int(info.MaxSubLayersMinus1)
+	profilePresent := make([]bool, subLayers)
+	levelPresent := make([]bool, subLayers)
+	for i := 0; i < subLayers; i++ {
+		profilePresent[i] = r.readBits(1) == 1
+		levelPresent[i] = r.readBits(1) == 1
+	}
+	if subLayers > 0 {
+		for i := subLayers; i < 8; i++ {
+			r.skipBits(2) // reserved_zero_2bits
+		}
+	}
+	for i := 0; i < subLayers; i++ {
+		if profilePresent[i] {
+			r.skipBits(88)
+		}
+		if levelPresent[i] {
+			r.skipBits(8)
+		}
+	}
+
+	r.readUE() // sps_seq_parameter_set_id
+	info.ChromaFormatIdc = uint8(r.readUE())
+	if info.ChromaFormatIdc == 3 {
+		r.skipBits(1) // separate_colour_plane_flag
+	}
+	r.readUE()              // pic_width_in_luma_samples
+	r.readUE()              // pic_height_in_luma_samples
+	if r.readBits(1) == 1 { // conformance_window_flag
+		r.readUE()
+		r.readUE()
+		r.readUE()
+		r.readUE()
+	}
+	info.BitDepthLumaMinus8 = uint8(r.readUE())
+	info.BitDepthChromaM8 = uint8(r.readUE())
+
+	if r.err != nil {
+		return info, r.err
+	}
+	return info, nil
+}
@@ -0,0 +1,195 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// PlayReady Object中的记录类型
+const (
+	playReadyRecordRightsManagementHeader = 0x0001
+)
+
+// PlayReadyHeader 解析后的PlayReady头（WRMHEADER）
+type PlayReadyHeader struct {
+	// 头版本，如 4.0.0.0、4.3.0.0
+	Version string
+	// KID列表，已转换为CENC字节序的32位小写十六进制
+	KIDs []string
+	// 许可证获取地址
+	LAURL string
+	// 许可证获取UI地址
+	LUIURL string
+	// 原始WRMHEADER XML
+	XML string
+}
+
+// KID 返回第一个KID
+func (h *PlayReadyHeader) KID() string {
+	if len(h.KIDs) == 0 {
+		return ""
+	}
+	return h.KIDs[0]
+}
+
+// wrmHeader WRMHEADER XML结构，兼容4.0至4.3版本
+type wrmHeader struct {
+	Version string `xml:"version,attr"`
+	Data    struct {
+		// 4.0: <KID>base64</KID>
+		KID string `xml:"KID"`
+		// 4.1: <PROTECTINFO><KID VALUE="..."/></PROTECTINFO>
+		// 4.2/4.3: <PROTECTINFO><KIDS><KID VALUE="..."/></KIDS></PROTECTINFO>
+		ProtectInfo struct {
+			KID  wrmKID `xml:"KID"`
+			KIDs struct {
+				KID []wrmKID `xml:"KID"`
+			} `xml:"KIDS"`
+		} `xml:"PROTECTINFO"`
+		LAURL  string `xml:"LA_URL"`
+		LUIURL string `xml:"LUI_URL"`
+	} `xml:"DATA"`
+}
+
+type wrmKID struct {
+	Value string `xml:"VALUE,attr"`
+}
+
+// ParsePlayReadyHeaderBase64 解析base64编码的PlayReady Object或WRMHEADER
+func ParsePlayReadyHeaderBase64(data string) (*PlayReadyHeader, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return nil, fmt.Errorf("PlayReady头base64解码失败: %w", err)
+	}
+	return ParsePlayReadyHeader(raw)
+}
+
+// ParsePlayReadyHeader 解析PlayReady Object，也接受不带PRO封装的UTF-16LE WRMHEADER
+func ParsePlayReadyHeader(data []byte) (*PlayReadyHeader, error) {
+	headerXML, err := extractWRMHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var header wrmHeader
+	if err := xml.Unmarshal([]byte(headerXML), &header); err != nil {
+		return nil, fmt.Errorf("解析WRMHEADER失败: %w", err)
+	}
+
+	result := &PlayReadyHeader{
+		Version: header.Version,
+		LAURL:   strings.TrimSpace(header.Data.LAURL),
+		LUIURL:  strings.TrimSpace(header.Data.LUIURL),
+		XML:     headerXML,
+	}
+
+	values := []string{header.Data.KID, header.Data.ProtectInfo.KID.Value}
+	for _, kid := range header.Data.ProtectInfo.KIDs.KID {
+		values = append(values, kid.Value)
+	}
+	for _, value := range values {
+		kid, err := PlayReadyKIDToCENC(value)
+		if err != nil {
+			continue
+		}
+		exists := false
+		for _, k := range result.KIDs {
+			if k == kid {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			result.KIDs = append(result.KIDs, kid)
+		}
+	}
+
+	if len(result.KIDs) == 0 {
+		return result, fmt.Errorf("WRMHEADER %s 中未找到KID", result.Version)
+	}
+	return result, nil
+}
+
+// PlayReadyKIDToCENC 将PlayReady的base64 GUID转换为CENC字节序的十六进制KID
+// PlayReady按小端GUID存储，前三段需要翻转字节序
+func PlayReadyKIDToCENC(value string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return "", fmt.Errorf("KID base64解码失败: %w", err)
+	}
+	if len(raw) != 16 {
+		return "", fmt.Errorf("KID长度无效: %d", len(raw))
+	}
+	return hex.EncodeToString(swapGUIDBytes(raw)), nil
+}
+
+// CENCKIDToPlayReady 将CENC字节序的十六进制KID转换为PlayReady的base64 GUID
+func CENCKIDToPlayReady(kid string) (string, error) {
+	raw, err := hex.DecodeString(NormalizeKID(kid))
+	if err != nil || len(raw) != 16 {
+		return "", fmt.Errorf("KID无效: %s", kid)
+	}
+	return base64.StdEncoding.EncodeToString(swapGUIDBytes(raw)), nil
+}
+
+// swapGUIDBytes 在小端GUID和大端UUID之间转换
+func swapGUIDBytes(raw []byte) []byte {
+	out := make([]byte, 16)
+	copy(out, raw)
+	out[0], out[1], out[2], out[3] = raw[3], raw[2], raw[1], raw[0]
+	out[4], out[5] = raw[5], raw[4]
+	out[6], out[7] = raw[7], raw[6]
+	return out
+}
+
+// extractWRMHeader 从PlayReady Object中取出WRMHEADER记录并解码为字符串
+func extractWRMHeader(data []byte) (string, error) {
+	// 不带PRO封装，直接是UTF-16LE的XML
+	if len(data) >= 2 && data[0] == '<' && data[1] == 0 {
+		return decodeUTF16LE(data), nil
+	}
+	if len(data) >= 4 && data[0] == 0xFF && data[1] == 0xFE {
+		return decodeUTF16LE(data[2:]), nil
+	}
+
+	if len(data) < 6 {
+		return "", fmt.Errorf("PlayReady Object长度不足")
+	}
+	length := binary.LittleEndian.Uint32(data[0:4])
+	if int(length) > len(data) {
+		return "", fmt.Errorf("PlayReady Object长度无效: %d", length)
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:6]))
+
+	pos := 6
+	for i := 0; i < count; i++ {
+		if pos+4 > len(data) {
+			break
+		}
+		recordType := binary.LittleEndian.Uint16(data[pos : pos+2])
+		recordLength := int(binary.LittleEndian.Uint16(data[pos+2 : pos+4]))
+		pos += 4
+		if pos+recordLength > len(data) {
+			break
+		}
+		if recordType == playReadyRecordRightsManagementHeader {
+			return decodeUTF16LE(data[pos : pos+recordLength]), nil
+		}
+		pos += recordLength
+	}
+
+	return "", fmt.Errorf("PlayReady Object中未找到WRMHEADER记录")
+}
+
+func decodeUTF16LE(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return strings.TrimPrefix(string(utf16.Decode(units)), "\ufeff")
+}
@@ -0,0 +1,149 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// PSSHInfo 解析后的pssh box
+type PSSHInfo struct {
+	// 规范化后的DRM系统ID
+	SystemID string
+	// DRM系统名称
+	Name    string
+	Version uint8
+	// pssh中声明的KID：v1的KID列表、Widevine的key_id或PlayReady头中的KID
+	KIDs []string
+	// 系统私有数据
+	Data []byte
+}
+
+// widevinePsshKeyIDField Widevine pssh数据（WidevinePsshData protobuf）中key_id的字段号
+const widevinePsshKeyIDField = 2
+
+// ParsePSSHBase64 解析base64编码的完整pssh box
+func ParsePSSHBase64(data string) (*PSSHInfo, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return nil, fmt.Errorf("pssh base64解码失败: %w", err)
+	}
+	return ParsePSSHBox(raw)
+}
+
+// ParsePSSHBox 解析包含box头的完整pssh box
+func ParsePSSHBox(box []byte) (*PSSHInfo, error) {
+	if len(box) < 12 || string(box[4:8]) != "pssh" {
+		return nil, fmt.Errorf("不是有效的pssh box")
+	}
+	size := int(binary.BigEndian.Uint32(box[0:4]))
+	if size < 12 || size > len(box) {
+		size = len(box)
+	}
+	return parsePSSHPayload(box[8], box[12:size])
+}
+
+// parsePSSHPayload 解析pssh box中version/flags之后的内容
+func parsePSSHPayload(version uint8, payload []byte) (*PSSHInfo, error) {
+	if len(payload) < 20 {
+		return nil, fmt.Errorf("pssh长度不足")
+	}
+	info := &PSSHInfo{
+		SystemID: NormalizeSystemID(hex.EncodeToString(payload[0:16])),
+		Version:  version,
+	}
+	info.Name = GetDRMSystemName(info.SystemID)
+	pos := 16
+
+	if version > 0 {
+		count := int(binary.BigEndian.Uint32(payload[pos : pos+4]))
+		pos += 4
+		if pos+count*16 > len(payload) {
+			return nil, fmt.Errorf("pssh KID数量无效: %d", count)
+		}
+		for i := 0; i < count; i++ {
+			info.KIDs = appendUniqueKID(info.KIDs, hex.EncodeToString(payload[pos:pos+16]))
+			pos += 16
+		}
+	}
+
+	if pos+4 > len(payload) {
+		return nil, fmt.Errorf("pssh缺少数据长度")
+	}
+	dataSize := int(binary.BigEndian.Uint32(payload[pos : pos+4]))
+	pos += 4
+	if pos+dataSize > len(payload) {
+		return nil, fmt.Errorf("pssh数据长度无效: %d", dataSize)
+	}
+	info.Data = payload[pos : pos+dataSize]
+
+	switch info.SystemID {
+	case WidevineSystemID:
+		for _, kid := range parseWidevinePSSHData(info.Data) {
+			info.KIDs = appendUniqueKID(info.KIDs, kid)
+		}
+	case PlayReadySystemID:
+		if header, err := ParsePlayReadyHeader(info.Data); err == nil {
+			for _, kid := range header.KIDs {
+				info.KIDs = appendUniqueKID(info.KIDs, kid)
+			}
+		}
+	}
+	return info, nil
+}
+
+// parseWidevinePSSHData 从WidevinePsshData protobuf中读取所有key_id
+func parseWidevinePSSHData(data []byte) []string {
+	var kids []string
+	for pos := 0; pos < len(data); {
+		tag, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			break
+		}
+		pos += n
+		field, wireType := tag>>3, tag&0x07
+
+		switch wireType {
+		case 0: // varint
+			_, n := binary.Uvarint(data[pos:])
+			if n <= 0 {
+				return kids
+			}
+			pos += n
+		case 1: // 64位
+			pos += 8
+		case 2: // 长度前缀
+			length, n := binary.Uvarint(data[pos:])
+			// 先与剩余长度比较再转换为int，过大的长度转换后可能为负数
+			if n <= 0 || length > uint64(len(data)-pos-n) {
+				return kids
+			}
+			pos += n
+			if field == widevinePsshKeyIDField && length == 16 {
+				kids = appendUniqueKID(kids, hex.EncodeToString(data[pos:pos+16]))
+			}
+			pos += int(length)
+		case 5: // 32位
+			pos += 4
+		default:
+			return kids
+		}
+	}
+	return kids
+}
+
+// appendUniqueKID 规范化KID后去重追加
+func appendUniqueKID(kids []string, kid string) []string {
+	kid = NormalizeKID(kid)
+	if kid == "" {
+		return kids
+	}
+	for _, k := range kids {
+		if k == kid {
+			return kids
+		}
+	}
+	return append(kids, kid)
+}
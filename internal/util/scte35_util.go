@@ -0,0 +1,213 @@
+package util
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// SCTE-35 splice command types.
+const (
+	SCTE35SpliceInsert = 0x05
+	SCTE35TimeSignal   = 0x06
+)
+
+// scte35AdStartTypes lists segmentation_type_id values that mark the start of an ad break.
+var scte35AdStartTypes = map[int]bool{
+	0x22: true, // Break Start
+	0x30: true, // Provider Advertisement Start
+	0x32: true, // Distributor Advertisement Start
+	0x34: true, // Provider Placement Opportunity Start
+	0x36: true, // Distributor Placement Opportunity Start
+	0x44: true, // Provider Ad Block Start
+	0x46: true, // Distributor Ad Block Start
+}
+
+// SCTE35Info holds the fields of a splice_info_section relevant to ad break detection.
+type SCTE35Info struct {
+	CommandType        int
+	SpliceEventID      uint32
+	OutOfNetwork       bool
+	BreakDuration      float64 // seconds, 0 if not signalled
+	SegmentationTypeID int     // -1 if no segmentation descriptor
+	SegmentationDur    float64 // seconds, 0 if not signalled
+}
+
+// IsAdBreakStart reports whether the message signals the start of an ad break.
+func (s *SCTE35Info) IsAdBreakStart() bool {
+	if s.CommandType == SCTE35SpliceInsert && s.OutOfNetwork {
+		return true
+	}
+	return scte35AdStartTypes[s.SegmentationTypeID]
+}
+
+// Duration returns the signalled break duration in seconds.
+func (s *SCTE35Info) Duration() float64 {
+	if s.BreakDuration > 0 {
+		return s.BreakDuration
+	}
+	return s.SegmentationDur
+}
+
+// IsSCTE35AdStartType reports whether a segmentation_type_id marks the start of an ad break.
+func IsSCTE35AdStartType(typeID int) bool {
+	return scte35AdStartTypes[typeID]
+}
+
+// ParseSCTE35 parses a binary SCTE-35 splice_info_section.
+// Only splice_insert, time_signal and segmentation descriptors are decoded.
+func ParseSCTE35(data []byte) (*SCTE35Info, error) {
+	if len(data) < 14 || data[0] != 0xFC {
+		return nil, fmt.Errorf("not a splice_info_section")
+	}
+	if data[4]&0x80 != 0 {
+		return nil, fmt.Errorf("encrypted splice_info_section is not supported")
+	}
+
+	info := &SCTE35Info{SegmentationTypeID: -1}
+	commandLength := int(binary.BigEndian.Uint16(data[11:13]) & 0x0FFF)
+	info.CommandType = int(data[13])
+
+	r := &byteCursor{data: data, pos: 14}
+	switch info.CommandType {
+	case SCTE35SpliceInsert:
+		parseSpliceInsert(r, info)
+	case SCTE35TimeSignal:
+		skipSpliceTime(r)
+	}
+
+	// 0xFFF means the command length is unknown and the cursor position is used instead.
+	if commandLength != 0x0FFF {
+		r.pos = 14 + commandLength
+	}
+	if r.err != nil || r.pos+2 > len(data) {
+		return info, nil
+	}
+
+	loopLength := int(r.u16())
+	end := r.pos + loopLength
+	if end > len(data) {
+		end = len(data)
+	}
+	for r.pos+2 <= end {
+		tag := r.u8()
+		length := int(r.u8())
+		next := r.pos + length
+		if next > end {
+			// Truncated descriptor: parse what is left, the loop ends here.
+			next = end
+		}
+		if tag == 0x02 && length >= 4 {
+			parseSegmentationDescriptor(&byteCursor{data: data[:next], pos: r.pos}, info)
+		}
+		r.pos = next
+	}
+
+	return info, nil
+}
+
+func parseSpliceInsert(r *byteCursor, info *SCTE35Info) {
+	info.SpliceEventID = r.u32()
+	if r.u8()&0x80 != 0 {
+		return // splice_event_cancel_indicator
+	}
+	flags := r.u8()
+	info.OutOfNetwork = flags&0x80 != 0
+	programSplice := flags&0x40 != 0
+	durationFlag := flags&0x20 != 0
+	immediate := flags&0x10 != 0
+
+	if programSplice && !immediate {
+		skipSpliceTime(r)
+	}
+	if !programSplice {
+		count := int(r.u8())
+		for i := 0; i < count; i++ {
+			r.u8() // component_tag
+			if !immediate {
+				skipSpliceTime(r)
+			}
+		}
+	}
+	if durationFlag {
+		info.BreakDuration = float64(r.u40()&0x1FFFFFFFF) / 90000
+	}
+}
+
+func skipSpliceTime(r *byteCursor) {
+	if r.peek()&0x80 != 0 {
+		r.skip(5)
+	} else {
+		r.skip(1)
+	}
+}
+
+func parseSegmentationDescriptor(r *byteCursor, info *SCTE35Info) {
+	if r.u32() != 0x43554549 { // "CUEI"
+		return
+	}
+	r.u32() // segmentation_event_id
+	if r.u8()&0x80 != 0 {
+		return // segmentation_event_cancel_indicator
+	}
+	flags := r.u8()
+	programSegmentation := flags&0x80 != 0
+	durationFlag := flags&0x40 != 0
+	if !programSegmentation {
+		count := int(r.u8())
+		r.skip(count * 6)
+	}
+	var duration float64
+	if durationFlag {
+		duration = float64(r.u40()) / 90000
+	}
+	r.u8()                // segmentation_upid_type
+	r.skip(int(r.u8()))   // segmentation_upid
+	typeID := int(r.u8()) // segmentation_type_id
+	if r.err != nil {
+		return
+	}
+
+	// Keep the first ad start descriptor, otherwise the first descriptor seen.
+	if info.SegmentationTypeID == -1 || (!scte35AdStartTypes[info.SegmentationTypeID] && scte35AdStartTypes[typeID]) {
+		info.SegmentationTypeID = typeID
+		info.SegmentationDur = duration
+	}
+}
+
+// byteCursor is a bounds-checked big-endian reader.
+type byteCursor struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (c *byteCursor) take(n int) []byte {
+	if c.err != nil || n < 0 || c.pos+n > len(c.data) {
+		c.err = fmt.Errorf("unexpected end of data")
+		c.pos = len(c.data)
+		return make([]byte, n)
+	}
+	b := c.data[c.pos : c.pos+n]
+	c.pos += n
+	return b
+}
+
+func (c *byteCursor) peek() byte {
+	if c.pos >= len(c.data) {
+		return 0
+	}
+	return c.data[c.pos]
+}
+
+func (c *byteCursor) skip(n int) { c.take(n) }
+func (c *byteCursor) u8() byte   { return c.take(1)[0] }
+func (c *byteCursor) u16() uint16 {
+	return binary.BigEndian.Uint16(c.take(2))
+}
+func (c *byteCursor) u32() uint32 {
+	return binary.BigEndian.Uint32(c.take(4))
+}
+func (c *byteCursor) u40() uint64 {
+	b := c.take(5)
+	return uint64(b[0])<<32 | uint64(binary.BigEndian.Uint32(b[1:]))
+}
@@ -403,6 +403,10 @@ func (sc *SpeedContainer) Add(bytes int64) {
 	defer sc.speedMutex.Unlock()
 	sc.Downloaded += bytes
 	sc.RDownloaded += bytes
+	// 撤回的字节可能已在上一个统计周期计入速度，当前周期不低于0
+	if sc.Downloaded < 0 {
+		sc.Downloaded = 0
+	}
 }
 
 func (sc *SpeedContainer) GetSpeed() int64 {